@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config [path]",
+	Short: "Prints the effective config for a path",
+	Long: `Config prints, as Cue, the config in effect for the stacks of the directory
+provided as path (default "."), followed by the sources it is composed of.
+
+Config sources, in increasing order of precedence:
+  built-in defaults
+  ~/.stax/config.stax.cue
+  config.stax.cue colocated with cue.mod
+  config.stax.cue in every directory from cue.mod down to path
+  the file provided by --config
+  STAX_* environment variables, named after the field path, eg:
+    STAX_PACKAGENAME, STAX_CMD_EXPORT_YMLPATH, STAX_ENVIRONMENTS=qa,live
+
+The nearest source wins: its concrete values replace those of the sources
+below it field by field, structs being merged and strings and lists replaced,
+rather than unified with them. Only the StackSchema and StackDefaults of every
+source are unified. PackageName is only
+read from the sources that apply to the cue root since it is needed to find the
+stacks.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		defer log.Flush()
+
+		path := "."
+		if len(args) > 0 {
+			path = args[0]
+		}
+		absPath, absPathErr := filepath.Abs(path)
+		if absPathErr != nil {
+			log.Fatal(absPathErr)
+			return
+		}
+
+		dirConfig, dirConfigErr := config.ForDir(absPath)
+		if dirConfigErr != nil {
+			log.Fatal(dirConfigErr)
+			return
+		}
+
+		formatted, formatErr := dirConfig.Format()
+		if formatErr != nil {
+			log.Fatal(formatErr)
+			return
+		}
+		log.Info(string(formatted))
+
+		log.Info()
+		log.Info("// Sources:")
+		log.Info("//   built-in defaults")
+		for _, source := range dirConfig.Sources {
+			log.Infof("//   %s\n", source)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
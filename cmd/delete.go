@@ -1,22 +1,26 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/build"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/cue-sh/stax/graph"
 	"github.com/cue-sh/stax/internal"
+	"github.com/cue-sh/stax/logger"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+	deleteCmd.Flags().BoolVarP(&flags.DeleteDeps, "dependencies", "d", false, "Delete stacks in reverse dependency order, dependents first.")
+	deleteCmd.Flags().StringSliceVar(&flags.DeleteRetainResources, "retain-resources", nil, "Logical IDs of resources to retain when deleting stacks in DELETE_FAILED.")
+	deleteCmd.Flags().StringVar(&flags.DeleteConfirm, "confirm", "", "Confirms the deletion without prompting, must be what the prompt expects.")
 }
 
 // deleteCmd represents the delete command
@@ -27,8 +31,25 @@ var deleteCmd = &cobra.Command{
 
 For each stack, delete will—as the name suggests—DELETE the stack!
 
-Beware that the only safety mechanism provided is a requirement to enter the
-stack name (case-sensitive match).
+The stacks about to be deleted are listed first, then the whole batch must be
+confirmed by entering the name of the stack, or "delete N stacks" when there
+are N stacks. --confirm provides the same text without prompting, e.g. in CI.
+
+Before anything is deleted, delete verifies that no stack outside the batch
+imports the exports of the stacks being deleted. Each deletion is awaited
+until DELETE_COMPLETE, see Cmd.Deploy.StackTimeout.
+
+--dependencies deletes stacks in reverse dependency order, so that stacks are
+deleted before the stacks they depend on, and skips the dependencies of a
+stack that failed to delete.
+
+--retain-resources retries stacks in DELETE_FAILED while retaining the
+resources that could not be deleted.
+
+Once a stack is deleted, the files written for it by export and save are
+removed: its template and parameters in any format, and its .out.cue outputs,
+as resolved by the config of the stack's directory. They are also dropped from
+the export manifest. The files of a stack that does not exist are kept.
 
 ** It your responsibility to ensure the proper authorization policies are 
 applied to the credentials being used! **
@@ -37,12 +58,15 @@ applied to the credentials being used! **
 
 		//TODO add debug messages
 		defer log.Flush()
+		defer log.Summary()
 
+		var stackNames []string
+		availableStacks := make(map[string]deployArgs)
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
 
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -52,71 +76,301 @@ applied to the credentials being used! **
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
-				log.Infof("%s %s %s %s:%s %s\n", au.Red("You are about to DELETE"), au.Magenta(stack.Name), au.Red("from"), au.Green(stack.Profile), au.Cyan(stack.Region), au.Red("."))
-				log.Infof("%s\n%s\n%s", au.Index(255-88, "Are you sure you want to DELETE this stack?"), au.Gray(11, "Enter the name of the stack to confirm."), au.Gray(11, "▶︎"))
-				var input string
-				fmt.Scanln(&input)
+				availableStacks[stack.Name] = deployArgs{stack: stack, buildInstance: buildInstance, stackValue: stackValue, dirConfig: dirConfig}
+				stackNames = append(stackNames, stack.Name)
+			}
+		})
 
-				if input != stack.Name {
-					continue
-				}
+		if len(stackNames) < 1 || ctx.Err() != nil {
+			return
+		}
 
-				// get a session and cloudformation service client
-				cfn := internal.GetCloudFormationClient(stack.Profile, stack.Region)
+		if flags.DeleteDeps {
+			ordered, orderErr := getDeletionOrder(stackNames, availableStacks)
+			if orderErr != nil {
+				log.Fatalf("Failed to resolve dependency graph: %s\n", orderErr)
+			}
+			stackNames = ordered
+		}
 
-				log.Infof("%s %s %s %s:%s\n", au.White("Deleting"), au.Magenta(stack.Name), au.White("⤎"), au.Green(stack.Profile), au.Cyan(stack.Region))
-				deleteStackInput := cloudformation.DeleteStackInput{StackName: aws.String(stack.Name)}
-				_, deleteStackErr := cfn.DeleteStack(context.TODO(), &deleteStackInput)
-				if deleteStackErr != nil {
-					log.Error(deleteStackErr)
-					continue
-				}
+		if !checkExportImporters(stackNames, availableStacks) {
+			return
+		}
 
-				// TODO DRY this out! It repeats in save.go
-				instancePath := buildInstance.Dir
-				cueOutPath := strings.Replace(instancePath, buildInstance.Root, "", 1)
-				dirs := strings.Split(instancePath, config.OsSeparator)
-				path := ""
-				for i := len(dirs); i > 0; i-- {
-					path = strings.Join(dirs[:i], config.OsSeparator)
-					if _, err := os.Stat(path + config.OsSeparator + "template.cfn.cue"); !os.IsNotExist(err) {
-						break // found it!
-					}
-				}
-				if path != "" {
-					cueOutPath = strings.Replace(path, buildInstance.Root, "", 1)
-				}
-				cueOutPath = strings.Replace(buildInstance.Root+"/cue.mod/usr/cfn.out"+cueOutPath, "-", "", -1)
-				outputsFileName := cueOutPath + "/" + stack.Name + ".out.cue"
-
-				if _, deleteOutputsErr := os.Stat(outputsFileName); deleteOutputsErr == nil {
-					deleteOutputsErr := os.Remove(outputsFileName)
-					if deleteOutputsErr != nil {
-						log.Error(deleteOutputsErr)
-					} else {
-						log.Infof("%s %s\n", au.White("Removed →"), au.Gray(11, outputsFileName))
-					}
-				} else {
-					log.Check()
-				}
+		if !confirmDeletion(stackNames, availableStacks) {
+			for _, stackName := range stackNames {
+				stack := availableStacks[stackName].stack
+				log.BeginStack(stack.Name, stack.Profile, stack.Region)
+				log.SkipStack("declined")
+				log.EndStack()
+			}
+			return
+		}
+
+		notDeleted := make(map[string]bool)
+		for _, stackName := range stackNames {
+			dlArgs := availableStacks[stackName]
+			if dependent := getNotDeletedDependent(stackName, stackNames, availableStacks, notDeleted); flags.DeleteDeps && dependent != "" {
+				log.BeginStack(dlArgs.stack.Name, dlArgs.stack.Profile, dlArgs.stack.Region)
+				log.SkipStack(dependent + " was not deleted")
+				log.EndStack()
+				notDeleted[stackName] = true
+				continue
+			}
+			if !deleteStack(dlArgs.dirConfig, dlArgs.stack, dlArgs.buildInstance) {
+				notDeleted[stackName] = true
+			}
+		}
+	},
+}
+
+// getDeletionOrder returns the stacks ordered so that every stack comes before the stacks it depends on.
+// Dependencies outside of the stacks being deleted are ignored
+func getDeletionOrder(stackNames []string, stacks map[string]deployArgs) ([]string, error) {
+	deletionGraph := graph.NewGraph()
+	for _, stackName := range stackNames {
+		var dependencies []string
+		for _, dependency := range stacks[stackName].stack.DependsOn {
+			if _, ok := stacks[dependency]; ok {
+				dependencies = append(dependencies, dependency)
+			}
+		}
+		deletionGraph.AddNode(stackName, dependencies...)
+	}
+
+	resolved, resolveErr := deletionGraph.Resolve()
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	for i, j := 0, len(resolved)-1; i < j; i, j = i+1, j-1 {
+		resolved[i], resolved[j] = resolved[j], resolved[i]
+	}
+	return resolved, nil
+}
 
-				dir := filepath.Clean(config.CueRoot + "/" + config.Cmd.Export.YmlPath + "/" + stack.Profile)
-				cfnFileName := dir + "/" + stack.Name + ".cfn.yml"
+// getNotDeletedDependent returns the name of a stack depending on stackName that was not deleted, if any
+func getNotDeletedDependent(stackName string, stackNames []string, stacks map[string]deployArgs, notDeleted map[string]bool) string {
+	for _, dependent := range stackNames {
+		if !notDeleted[dependent] {
+			continue
+		}
+		for _, dependency := range stacks[dependent].stack.DependsOn {
+			if dependency == stackName {
+				return dependent
+			}
+		}
+	}
+	return ""
+}
 
-				if _, deleteCfnErr := os.Stat(cfnFileName); deleteCfnErr == nil {
-					deleteCfnErr := os.Remove(cfnFileName)
-					if deleteCfnErr != nil {
-						log.Error(deleteCfnErr)
-					} else {
-						log.Infof("%s %s\n", au.White("Removed →"), au.Gray(11, cfnFileName))
+// checkExportImporters returns false when an export of a stack is imported by a stack outside of the batch,
+// or by a stack of the batch that is deleted after it
+func checkExportImporters(stackNames []string, stacks map[string]deployArgs) bool {
+	order := make(map[string]int)
+	for i, stackName := range stackNames {
+		order[stackName] = i
+	}
+
+	log.Infof("%s", au.Gray(11, "Checking exports..."))
+	passed := true
+	for i, stackName := range stackNames {
+		stack := stacks[stackName].stack
+		cfn := internal.GetCloudFormationClient(stack.Profile, stack.Region)
+		describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)})
+		if describeStacksErr != nil {
+			if internal.IsStackNotFound(describeStacksErr) {
+				continue
+			}
+			log.X()
+			log.Fatal(describeStacksErr)
+		}
+
+		importers, importersErr := internal.GetExportImporters(ctx, cfn, describeStacksOutput.Stacks[0])
+		if importersErr != nil {
+			log.X()
+			log.Fatal(importersErr)
+		}
+		for exportName, importingStacks := range importers {
+			for _, importer := range importingStacks {
+				importerOrder, inBatch := order[importer]
+				if !inBatch {
+					if passed {
+						log.X()
+					}
+					passed = false
+					log.Errorf("  %s exports %s, imported by %s which is not being deleted\n", stack.Name, exportName, importer)
+				} else if importerOrder > i {
+					if passed {
+						log.X()
 					}
-				} else {
-					log.Check()
+					passed = false
+					log.Errorf("  %s exports %s, imported by %s which would be deleted after it, see --dependencies\n", stack.Name, exportName, importer)
 				}
 			}
-		})
-	},
+		}
+	}
+	if passed {
+		log.Check()
+	}
+	return passed
+}
+
+// confirmDeletion lists the stacks about to be deleted and asks to confirm the whole batch by entering the stack name,
+// or "delete N stacks" for N stacks. --confirm provides the same text without prompting
+func confirmDeletion(stackNames []string, stacks map[string]deployArgs) bool {
+	expected := stackNames[0]
+	if len(stackNames) > 1 {
+		expected = fmt.Sprintf("delete %d stacks", len(stackNames))
+	}
+
+	log.Infof("%s\n", au.Red("You are about to DELETE:"))
+	for i, stackName := range stackNames {
+		stack := stacks[stackName].stack
+		log.Infof("  %d. %s %s:%s\n", i+1, au.Magenta(stack.Name), au.Green(stack.Profile), au.Cyan(stack.Region))
+	}
+
+	if flags.DeleteConfirm != "" {
+		if flags.DeleteConfirm != expected {
+			log.Errorf("--confirm must be %q\n", expected)
+			return false
+		}
+		return true
+	}
+
+	log.Infof("%s\n%s\n%s", au.Index(255-88, "Are you sure you want to DELETE these stacks?"), au.Gray(11, "Enter "+expected+" to confirm."), au.Gray(11, "▶︎"))
+	input, _ := readLine(ctx)
+	return input == expected
+}
+
+// deleteStack deletes the stack, waits for DELETE_COMPLETE and then removes its local artifacts as resolved by dirConfig,
+// the config of the stack's directory. returns true if the stack no longer exists
+func deleteStack(dirConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance) bool {
+	log.BeginStack(stack.Name, stack.Profile, stack.Region)
+	defer log.EndStack()
+	if ctx.Err() != nil {
+		log.SkipStack("interrupted")
+		return false
+	}
+
+	// get a session and cloudformation service client
+	cfn := internal.GetCloudFormationClient(stack.Profile, stack.Region)
+
+	log.Infof("%s %s %s %s:%s\n", au.White("Deleting"), au.Magenta(stack.Name), au.White("⤎"), au.Green(stack.Profile), au.Cyan(stack.Region))
+	describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)})
+	if describeStacksErr != nil {
+		if !internal.IsStackNotFound(describeStacksErr) {
+			log.Error(describeStacksErr)
+			return false
+		}
+		// files exported for review of a stack that was never deployed are kept
+		log.Infof("%s\n", au.Gray(11, "  Stack does not exist, its exported and saved files are kept."))
+		log.SkipStack("does not exist")
+		return true
+	}
+
+	// stacks of the batch importing the exports are deleted by now, unless they failed to
+	importers, importersErr := internal.GetExportImporters(ctx, cfn, describeStacksOutput.Stacks[0])
+	if importersErr != nil {
+		log.Error(importersErr)
+		return false
+	}
+	if len(importers) > 0 {
+		for exportName, importingStacks := range importers {
+			log.Errorf("  Export %s is still imported by %s\n", exportName, strings.Join(importingStacks, ", "))
+		}
+		return false
+	}
+
+	deleteStackInput := cloudformation.DeleteStackInput{StackName: aws.String(stack.Name)}
+	if describeStacksOutput.Stacks[0].StackStatus == types.StackStatusDeleteFailed && len(flags.DeleteRetainResources) > 0 {
+		log.Infof("%s\n", au.Gray(11, "  Retaining "+strings.Join(flags.DeleteRetainResources, ", ")))
+		deleteStackInput.RetainResources = flags.DeleteRetainResources
+	}
+	_, deleteStackErr := cfn.DeleteStack(ctx, &deleteStackInput)
+	if deleteStackErr != nil {
+		log.Error(deleteStackErr)
+		return false
+	}
+
+	log.Infof("%s", au.Gray(11, "  Waiting for stack..."))
+	stackWaiter, stackWaiterErr := internal.StackWaiter(dirConfig, stack)
+	if stackWaiterErr != nil {
+		log.X()
+		log.Error(stackWaiterErr)
+		return false
+	}
+	stackStatus, waitErr := stackWaiter.WaitForStack(ctx, cfn, stack.Name)
+	if ctx.Err() != nil {
+		log.X()
+		log.SkipStack("interrupted")
+		log.Warnf("%s keeps deleting, follow it with stax events\n", stack.Name)
+		return false
+	}
+	if waitErr != nil {
+		log.X()
+		log.Error(waitErr)
+		log.Warnf("%s keeps deleting, follow it with stax events\n", stack.Name)
+		return false
+	}
+	if stackStatus != types.StackStatusDeleteComplete {
+		log.X()
+		log.Errorf("Stack failed with status %s\n", stackStatus)
+		log.SetExitCode(logger.ExitChangeSetFailed)
+		logRetainableResources(cfn, stack.Name)
+		return false
+	}
+	log.Check()
+
+	removeStackArtifacts(dirConfig, stack, buildInstance)
+	return true
+}
+
+// logRetainableResources lists the resources that failed to delete, for --retain-resources
+func logRetainableResources(cfn *cloudformation.Client, stackName string) {
+	describeStackResourcesOutput, describeStackResourcesErr := cfn.DescribeStackResources(ctx, &cloudformation.DescribeStackResourcesInput{StackName: aws.String(stackName)})
+	if describeStackResourcesErr != nil {
+		log.Debug(describeStackResourcesErr)
+		return
+	}
+	var failed []string
+	for _, resource := range describeStackResourcesOutput.StackResources {
+		if resource.ResourceStatus == types.ResourceStatusDeleteFailed {
+			failed = append(failed, aws.ToString(resource.LogicalResourceId))
+			log.Infof("  %s %s\n", au.Red(aws.ToString(resource.LogicalResourceId)), aws.ToString(resource.ResourceStatusReason))
+		}
+	}
+	if len(failed) > 0 {
+		log.Infof("%s\n", au.Gray(11, "  To delete the stack but keep these resources, retry with --retain-resources "+strings.Join(failed, ",")))
+	}
+}
+
+// removeStackArtifacts removes the exported template and parameters, and the saved outputs of the stack, and drops
+// them from the export manifest
+func removeStackArtifacts(dirConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance) {
+	var removed []string
+	for _, fileName := range internal.GetStackArtifacts(dirConfig, stack, buildInstance).Files() {
+		removeErr := os.Remove(fileName)
+		if os.IsNotExist(removeErr) {
+			continue
+		}
+		if removeErr != nil {
+			log.Error(removeErr)
+			continue
+		}
+		removed = append(removed, fileName)
+		log.Infof("%s %s\n", au.White("Removed →"), au.Gray(11, fileName))
+	}
+	if len(removed) == 0 {
+		log.Infof("%s\n", au.Gray(11, "  No exported or saved files to remove."))
+		return
+	}
+
+	// export keeps a manifest in the YmlPath of the stack's directory config
+	manifestErr := dropFromExportManifest(exportYmlPath(dirConfig), removed)
+	if manifestErr != nil {
+		log.Error(manifestErr)
+	}
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cue-sh/stax/internal"
+)
+
+func TestGetDeletionOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// dependsOn are the DependsOn of every stack being deleted
+		dependsOn map[string][]string
+		wantErr   bool
+	}{
+		{
+			name:      "independent stacks",
+			dependsOn: map[string][]string{"a": nil, "b": nil},
+		},
+		{
+			name:      "chain",
+			dependsOn: map[string][]string{"vpc": nil, "db": {"vpc"}, "app": {"db", "vpc"}},
+		},
+		{
+			name:      "diamond",
+			dependsOn: map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}},
+		},
+		{
+			name:      "dependency outside of the batch is ignored",
+			dependsOn: map[string][]string{"app": {"vpc"}},
+		},
+		{
+			name:      "cycle",
+			dependsOn: map[string][]string{"a": {"b"}, "b": {"a"}},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stacks := make(map[string]deployArgs)
+			var stackNames []string
+			for name, dependsOn := range test.dependsOn {
+				stacks[name] = deployArgs{stack: internal.Stack{Name: name, DependsOn: dependsOn}}
+				stackNames = append(stackNames, name)
+			}
+			sort.Strings(stackNames)
+
+			order, orderErr := getDeletionOrder(stackNames, stacks)
+			if test.wantErr {
+				if orderErr == nil {
+					t.Fatalf("expected an error, got %v", order)
+				}
+				return
+			}
+			if orderErr != nil {
+				t.Fatal(orderErr)
+			}
+
+			if len(order) != len(stackNames) {
+				t.Fatalf("expected %d stacks, got %v", len(stackNames), order)
+			}
+			position := make(map[string]int)
+			for i, name := range order {
+				position[name] = i
+			}
+			for name, dependsOn := range test.dependsOn {
+				for _, dependency := range dependsOn {
+					if _, ok := stacks[dependency]; ok && position[name] > position[dependency] {
+						t.Errorf("%s is deleted after its dependency %s: %v", name, dependency, order)
+					}
+				}
+			}
+		})
+	}
+}
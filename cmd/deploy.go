@@ -2,13 +2,9 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
-	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/build"
@@ -18,9 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/cue-sh/stax/graph"
 	"github.com/cue-sh/stax/internal"
-	"github.com/olekukonko/tablewriter"
+	"github.com/cue-sh/stax/logger"
 	"github.com/spf13/cobra"
-	goYaml "gopkg.in/yaml.v2"
 )
 
 func init() {
@@ -46,6 +41,8 @@ type deployArgs struct {
 	stack         internal.Stack
 	stackValue    cue.Value
 	buildInstance *build.Instance
+	// dirConfig is the config of the stack's directory
+	dirConfig *internal.Config
 }
 
 // deployCmd represents the deploy command
@@ -57,10 +54,19 @@ var deployCmd = &cobra.Command{
 For each stack, a changeset is first created, and the proposed changes are
 displayed. At this point you have the option to execute the changeset
 before moving on to the next stack.
+
+Change sets do not carry termination protection, once the changeset is
+executed, or when it has no changes, the stack's EnableTerminationProtection
+is applied if it differs from the deployed stack.
+
+On Ctrl-C, no further stack is deployed and deploy offers to delete the
+pending change set, or to cancel the update in progress. A second Ctrl-C
+exits immediately.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		defer log.Flush()
+		defer log.Summary()
 
 		if flags.DeployExecuteOnly && flags.DeployNoExecute {
 			log.Fatal("Cannot set both --no-execute and --execute-only")
@@ -75,8 +81,8 @@ before moving on to the next stack.
 		workingGraph := graph.NewGraph()
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -89,14 +95,14 @@ before moving on to the next stack.
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
 					if flags.DeployDeps {
-						log.Fatal(decodeErr)
+						log.Fatal(internal.StackError(decodeErr, buildInstance, stackValue))
 					} else {
-						log.Error(decodeErr)
+						log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 						continue
 					}
 				}
 
-				availableStacks[stack.Name] = deployArgs{stack: stack, buildInstance: buildInstance, stackValue: stackValue}
+				availableStacks[stack.Name] = deployArgs{stack: stack, buildInstance: buildInstance, stackValue: stackValue, dirConfig: dirConfig}
 				if flags.DeployDeps {
 					workingGraph.AddNode(stack.Name, stack.DependsOn...)
 				}
@@ -111,19 +117,31 @@ before moving on to the next stack.
 
 			for _, stackName := range resolved {
 				dplArgs := availableStacks[stackName]
-				deployStack(dplArgs.stack, dplArgs.buildInstance, dplArgs.stackValue)
+				deployStack(dplArgs.dirConfig, dplArgs.stack, dplArgs.buildInstance, dplArgs.stackValue)
 			}
 		} else {
 			for _, dplArgs := range availableStacks {
-				deployStack(dplArgs.stack, dplArgs.buildInstance, dplArgs.stackValue)
+				deployStack(dplArgs.dirConfig, dplArgs.stack, dplArgs.buildInstance, dplArgs.stackValue)
 			}
 		}
 	},
 }
 
-func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) {
+// deployStack deploys the stack with dirConfig, the config of the stack's directory
+func deployStack(dirConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) {
+
+	log.BeginStack(stack.Name, stack.Profile, stack.Region)
+	defer log.EndStack()
+	if ctx.Err() != nil {
+		log.SkipStack("interrupted")
+		return
+	}
 
 	log.Infof("%s %s %s %s:%s\n", au.White("Deploying"), au.Magenta(stack.Name), au.White("⤏"), au.Green(stack.Profile), au.Cyan(stack.Region))
+	if !checkPolicies(dirConfig, stackValue) {
+		log.Infof("%s\n", au.Red("  Deployment blocked by policy violations"))
+		return
+	}
 	log.Debug("Getting change set name")
 	changeSetName, changeSetNameErr := getChangeSetName(stack, stackValue)
 	if changeSetNameErr != nil {
@@ -144,7 +162,7 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 		template := stackValue.Lookup("Template")
 		templateBody, ymlErr := cueYaml.Marshal(template)
 		if ymlErr != nil {
-			log.Error(ymlErr)
+			log.Error(internal.StackError(ymlErr, buildInstance, stackValue))
 			return
 		}
 
@@ -152,7 +170,7 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 		validateTemplateInput := &cloudformation.ValidateTemplateInput{
 			TemplateBody: aws.String(templateBody),
 		}
-		validateTemplateOutput, validateTemplateErr := cfn.ValidateTemplate(context.TODO(), validateTemplateInput)
+		validateTemplateOutput, validateTemplateErr := cfn.ValidateTemplate(ctx, validateTemplateInput)
 
 		// template failed to validate
 		if validateTemplateErr != nil {
@@ -165,7 +183,7 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 		// look to see if stack exists
 		log.Debug("  Describing", stack.Name)
-		_, describeStacksErr := cfn.DescribeStacks(context.TODO(), &describeStacksInput)
+		_, describeStacksErr := cfn.DescribeStacks(ctx, &describeStacksInput)
 
 		createChangeSetInput := cloudformation.CreateChangeSetInput{
 			Capabilities:  validateTemplateOutput.Capabilities,
@@ -183,131 +201,38 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 		createChangeSetInput.ChangeSetType = types.ChangeSetType(changeSetType)
 
-		stackParametersValue := stackValue.Lookup("Template", "Parameters")
-		if stackParametersValue.Exists() {
-
-			// TODO paramaters need to support the type as declared in Parameter.Type (in the least string and number).
-			// this should be map[string]interface{} with type casting done when adding parameters to the changeset
-			parametersMap := make(map[string]string)
-			var parameters []types.Parameter
-
-			if flags.DeployPrevious {
-				// deploy using previous values
-				stackParameters, stackParametersErr := stackParametersValue.Fields()
-				if stackParametersErr != nil {
-					log.Fatal(stackParametersErr)
-					return
-				}
-				log.Infof("%s", au.Gray(11, "  Using previous parameters..."))
-				for stackParameters.Next() {
-					stackParam := stackParameters.Value()
-					key, _ := stackParam.Label()
-					parametersMap[key] = ""
-				}
-				log.Check()
-			} else {
-				// load overrides
-
-				// TODO #48 stax should prompt for each Parameter input if overrides are undefined
-				if len(stack.Overrides) < 1 {
-					log.Fatal("Template has Parameters but no Overrides are defined.")
-					return
-				}
-
-				for k, v := range stack.Overrides {
-					path := strings.Replace(k, "${STX::CuePath}", strings.Replace(buildInstance.Dir, buildInstance.Root+"/", "", 1), 1)
-					behavior := v
-
-					log.Infof("%s", au.Gray(11, "  Applying overrides: "+path+" "))
-
-					var yamlBytes []byte
-					var yamlBytesErr error
-
-					if behavior.SopsProfile != "" {
-						// decrypt the file contents
-						yamlBytes, yamlBytesErr = internal.DecryptSecrets(filepath.Clean(buildInstance.Root+"/"+path), behavior.SopsProfile)
-					} else {
-						// just pull the file contents directly
-						yamlBytes, yamlBytesErr = ioutil.ReadFile(filepath.Clean(buildInstance.Root + "/" + path))
-					}
-
-					if yamlBytesErr != nil {
-						log.Fatal(yamlBytesErr)
-						return
-					}
-
-					// TODO #47 parameters need to support the type as declared in Parameter.Type (in the least string and number).
-					// this should be map[string]interface{} with type casting done when adding parameters to the changeset
-					var override map[string]string
-
-					yamlUnmarshalErr := goYaml.Unmarshal(yamlBytes, &override)
-					if yamlUnmarshalErr != nil {
-						log.Fatal(yamlUnmarshalErr)
-						return
-					}
-
-					// TODO #50 stax should error when a parameter key is duplicated among two or more overrides files
-					if len(behavior.Map) > 0 {
-						// map the yaml key:value to parameter key:value
-						for k, v := range behavior.Map {
-							fromKey := k
-							toKey := v
-							parametersMap[toKey] = override[fromKey]
-						}
-					} else {
-						// just do a straight copy, keys should align 1:1
-						for k, v := range override {
-							overrideKey := k
-							overrideVal := v
-							parametersMap[overrideKey] = overrideVal
-						}
-					}
-					log.Check()
-				}
-			}
-
-			// apply parameters to changeset
-			for k, v := range parametersMap {
-				paramKey := k
-				paramVal := v
-				parameter := types.Parameter{ParameterKey: aws.String(paramKey)}
-
-				if flags.DeployPrevious {
-					parameter.UsePreviousValue = aws.Bool(true)
-				} else {
-					parameter.ParameterValue = aws.String(paramVal)
-				}
-
-				parameters = append(parameters, parameter)
+		// adopt existing resources into the stack rather than creating them
+		if flags.ImportResources {
+			resourcesToImport, resourcesToImportErr := internal.GetResourcesToImport(stack, stackValue)
+			if resourcesToImportErr != nil {
+				log.Error(internal.StackError(resourcesToImportErr, buildInstance, stackValue))
+				return
 			}
+			log.Infof("%s", au.Gray(11, fmt.Sprintf("  Importing %d resources...", len(resourcesToImport))))
+			createChangeSetInput.ChangeSetType = types.ChangeSetTypeImport
+			createChangeSetInput.ResourcesToImport = resourcesToImport
+			log.Check()
+		}
 
-			createChangeSetInput.Parameters = parameters
-
-		} // end stackParametersValue.Exists()
-
-		// handle Stack.Tags
-		if len(stack.Tags) > 0 && stack.TagsEnabled {
-			var tags []types.Tag
-			for k, v := range stack.Tags {
-				tagK := k // reassign here to avoid issues with for-scope var
-				var tagV string
-				switch v {
-				default:
-					tagV = v
-				case "${STX::CuePath}":
-					tagV = strings.Replace(buildInstance.Dir, buildInstance.Root, "", 1)
-				}
-				tags = append(tags, types.Tag{Key: &tagK, Value: &tagV})
-			}
-			createChangeSetInput.Tags = tags
+		parameters, parametersErr := getParameters(stack, buildInstance, stackValue)
+		if parametersErr != nil {
+			log.Fatal(internal.StackError(parametersErr, buildInstance, stackValue))
+			return
 		}
+		createChangeSetInput.Parameters = parameters
+		createChangeSetInput.Tags = getTags(stack, buildInstance)
+		createChangeSetInput.NotificationARNs = stack.NotificationARNs
 
 		if stack.Role != "" {
 			log.Infof("%s", au.Gray(11, "  Applying role: "+stack.Role+"\n"))
 			createChangeSetInput.RoleARN = aws.String(stack.Role)
 		}
 
-		_, createChangeSetErr := cfn.CreateChangeSet(context.TODO(), &createChangeSetInput)
+		_, createChangeSetErr := cfn.CreateChangeSet(ctx, &createChangeSetInput)
+		if ctx.Err() != nil {
+			offerDeleteChangeSet(cfn, stack.Name, changeSetName)
+			return
+		}
 
 		if createChangeSetErr != nil {
 			log.Infof(" %s\n", au.Red(createChangeSetErr))
@@ -316,7 +241,7 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 				deleteChangesetInput.ChangeSetName = createChangeSetInput.ChangeSetName
 				deleteChangesetInput.StackName = createChangeSetInput.StackName
 				log.Infof("%s %s\n", au.White("Deleting"), au.BrightBlue(changeSetName))
-				_, deleteChangeSetErr := cfn.DeleteChangeSet(context.TODO(), &deleteChangesetInput)
+				_, deleteChangeSetErr := cfn.DeleteChangeSet(ctx, &deleteChangesetInput)
 				if deleteChangeSetErr != nil {
 					log.Error(deleteChangeSetErr)
 				}
@@ -326,30 +251,22 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 		log.Infof("%s %s", au.Gray(11, "  Awaiting changeset"), au.BrightBlue(changeSetName))
 
-		describeChangesetInput := cloudformation.DescribeChangeSetInput{
-			ChangeSetName: aws.String(changeSetName),
-			StackName:     aws.String(stack.Name),
+		changeSetWaiter, changeSetWaiterErr := internal.ChangeSetWaiter(dirConfig, stack)
+		if changeSetWaiterErr != nil {
+			log.X()
+			log.Error(changeSetWaiterErr)
+			return
 		}
-
-		var describeChangesetOuput *cloudformation.DescribeChangeSetOutput
-		var describeChangesetErr error
-
-		// TODO: make this a waiter when v2 finally supports them
-		// waits for 10m polling every 5s
-		for i := 0; i < 120; i++ {
-			describeChangesetOuput, describeChangesetErr = cfn.DescribeChangeSet(context.TODO(), &describeChangesetInput)
-			if describeChangesetErr != nil {
-				log.X()
-				log.Fatalf("%+v", au.Red(describeChangesetErr))
-				break
-			}
-
-			if describeChangesetOuput.Status != types.ChangeSetStatusCreateInProgress && describeChangesetOuput.Status != types.ChangeSetStatusCreatePending {
-				break
-			}
-
-			log.Debugf("Changeset is %s. Polling again in 5s.\n", describeChangesetOuput.Status)
-			time.Sleep(5 * time.Second)
+		describeChangesetOuput, describeChangesetErr := changeSetWaiter.WaitForChangeSet(ctx, cfn, stack.Name, changeSetName)
+		if ctx.Err() != nil {
+			log.X()
+			offerDeleteChangeSet(cfn, stack.Name, changeSetName)
+			return
+		}
+		if describeChangesetErr != nil {
+			log.X()
+			log.Error(describeChangesetErr)
+			return
 		}
 
 		log.Check()
@@ -358,15 +275,31 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 		if describeChangesetOuput.ExecutionStatus != types.ExecutionStatusAvailable || describeChangesetOuput.Status != types.ChangeSetStatusCreateComplete {
 			//TODO put describeChangesetOuput into table view
-			log.Debugf("%+v\n", describeChangesetOuput)
-			log.Info(au.Yellow("No changes to deploy."))
+			// parameter values may be secrets
+			maskedOutput := *describeChangesetOuput
+			maskedOutput.Parameters = maskParameters(describeChangesetOuput.Parameters)
+			log.Debugf("%+v\n", maskedOutput)
+
+			statusReason := aws.ToString(describeChangesetOuput.StatusReason)
+			if describeChangesetOuput.Status == types.ChangeSetStatusFailed && !strings.Contains(statusReason, "didn't contain changes") && !strings.Contains(statusReason, "No updates are to be performed") {
+				log.Errorf("Change set failed: %s\n", statusReason)
+				log.SetExitCode(logger.ExitChangeSetFailed)
+			} else if strings.HasPrefix(string(describeChangesetOuput.Status), "DELETE_") {
+				log.Errorf("Change set is %s\n", describeChangesetOuput.Status)
+				log.SetExitCode(logger.ExitChangeSetFailed)
+				return
+			} else {
+				log.Info(au.Yellow("No changes to deploy."))
+				log.SkipStack("no changes")
+				applyTerminationProtection(cfn, stack)
+			}
 
 			var deleteChangesetInput cloudformation.DeleteChangeSetInput
 			deleteChangesetInput.ChangeSetName = createChangeSetInput.ChangeSetName
 			deleteChangesetInput.StackName = createChangeSetInput.StackName
 			log.Infof("%s %s\n", au.White("Deleting"), au.BrightBlue(changeSetName))
 
-			_, deleteChangeSetErr := cfn.DeleteChangeSet(context.TODO(), &deleteChangesetInput)
+			_, deleteChangeSetErr := cfn.DeleteChangeSet(ctx, &deleteChangesetInput)
 			if deleteChangeSetErr != nil {
 				log.Error(deleteChangeSetErr)
 			}
@@ -375,12 +308,9 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 		if len(describeChangesetOuput.Changes) > 0 {
 			// log.Infof("%+v\n", describeChangesetOuput.Changes)
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoWrapText(false)
+			table := log.NewTable("Resource", "Action", "Attribute", "Property", "Recreation")
 			table.SetAutoMergeCells(true)
 			table.SetRowLine(true)
-			table.SetHeader([]string{"Resource", "Action", "Attribute", "Property", "Recreation"})
-			table.SetHeaderColor(tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor})
 
 			for _, change := range describeChangesetOuput.Changes {
 
@@ -412,26 +342,30 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 			table.Render()
 		}
 
-		diff(cfn, stack.Name, templateBody)
+		diff(cfn, &createChangeSetInput, stackValue, false)
 
 		if flags.DeployNoExecute {
+			log.SkipStack("not executed")
 			return
 		}
 
 		log.Infof("%s %s %s %s:%s:%s %s\n", au.Index(255-88, "Execute change set"), au.BrightBlue(changeSetName), au.White("⤏"), au.Magenta(stack.Name), au.Green(stack.Profile), au.Cyan(stack.Region), au.Index(255-88, "?"))
 		log.Infof("%s\n%s", au.Gray(11, "Y to execute. Anything else to cancel."), au.Gray(11, "▶︎"))
-		var input string
-		fmt.Scanln(&input)
-
-		input = strings.ToLower(input)
-		matched, _ := regexp.MatchString("^(y){1}(es)?$", input)
+		matched := confirm(ctx)
+		if ctx.Err() != nil {
+			offerDeleteChangeSet(cfn, stack.Name, changeSetName)
+			return
+		}
 		if !matched {
+			// declining is a choice rather than an interruption, it records no exit code
+			log.SkipStack("declined")
+
 			// delete changeset and continue
 			var deleteChangesetInput cloudformation.DeleteChangeSetInput
 			deleteChangesetInput.ChangeSetName = createChangeSetInput.ChangeSetName
 			deleteChangesetInput.StackName = createChangeSetInput.StackName
 			log.Infof("%s %s\n", au.White("Deleting"), au.BrightBlue(changeSetName))
-			_, deleteChangeSetErr := cfn.DeleteChangeSet(context.TODO(), &deleteChangesetInput)
+			_, deleteChangeSetErr := cfn.DeleteChangeSet(ctx, &deleteChangesetInput)
 			if deleteChangeSetErr != nil {
 				log.Error(deleteChangeSetErr)
 			}
@@ -446,47 +380,50 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 
 	log.Infof("%s %s %s %s:%s:%s\n", au.White("Executing"), au.BrightBlue(changeSetName), au.White("⤏"), au.Magenta(stack.Name), au.Green(stack.Profile), au.Cyan(stack.Region))
 
-	_, executeChangeSetErr := cfn.ExecuteChangeSet(context.TODO(), &executeChangeSetInput)
+	_, executeChangeSetErr := cfn.ExecuteChangeSet(ctx, &executeChangeSetInput)
 
 	if executeChangeSetErr != nil {
 		log.Fatal(executeChangeSetErr)
 	}
 
+	applyTerminationProtection(cfn, stack)
+
 	if flags.DeploySave || flags.DeployWait {
 		log.Infof("%s", au.Gray(11, "  Waiting for stack..."))
 
-		var describeStacksOuput *cloudformation.DescribeStacksOutput
-		var describeStacksErr error
-		var stackStatus types.StackStatus
-
-		// TODO make this a waiter when v2 supports them
-		// wait for 1h polling every 5s
-		for i := 0; i < 720; i++ {
-			describeStacksOuput, describeStacksErr = cfn.DescribeStacks(context.TODO(), &describeStacksInput)
-			if describeStacksErr != nil {
-				log.Fatalf("%+v", au.Red(describeStacksErr))
-				break
-			}
-
-			stackStatus = describeStacksOuput.Stacks[0].StackStatus
-			if stackStatus != types.StackStatusCreateInProgress &&
-				stackStatus != types.StackStatusUpdateInProgress &&
-				stackStatus != types.StackStatusUpdateCompleteCleanupInProgress &&
-				stackStatus != types.StackStatusImportInProgress {
-				break
-			}
-
-			log.Debugf("Stack is %s. Polling again in 5s.\n", stackStatus)
-			time.Sleep(5 * time.Second)
+		stackWaiter, stackWaiterErr := internal.StackWaiter(dirConfig, stack)
+		if stackWaiterErr != nil {
+			log.X()
+			log.Error(stackWaiterErr)
+			return
+		}
+		stackStatus, waitErr := stackWaiter.WaitForStack(ctx, cfn, stack.Name)
+		if ctx.Err() != nil {
+			log.X()
+			offerCancelUpdate(cfn, stack.Name, stackStatus)
+			return
+		}
+		if waitErr != nil {
+			// a stack that timed out keeps deploying
+			log.X()
+			log.Error(waitErr)
+			log.Warnf("%s keeps deploying, follow it with stax events\n", stack.Name)
+			return
 		}
 
-		if stackStatus != types.StackStatusCreateComplete && stackStatus != types.StackStatusUpdateComplete {
-			log.Errorf("Stack failed with status %s", stackStatus)
+		if !internal.StackStatusSucceeded(stackStatus) || stackStatus == types.StackStatusDeleteComplete {
+			log.X()
+			log.Errorf("Stack failed with status %s\n", stackStatus)
+			if internal.StackStatusRolledBack(stackStatus) {
+				log.SetExitCode(logger.ExitRolledBack)
+			} else {
+				log.SetExitCode(logger.ExitChangeSetFailed)
+			}
 		} else {
 			log.Check()
 
 			if flags.DeploySave {
-				saveErr := saveStackOutputs(config, buildInstance, stack)
+				saveErr := saveStackOutputs(dirConfig, buildInstance, stack)
 				if saveErr != nil {
 					log.Fatal(saveErr)
 				}
@@ -494,3 +431,247 @@ func deployStack(stack internal.Stack, buildInstance *build.Instance, stackValue
 		}
 	}
 }
+
+// applyTerminationProtection sets the termination protection of the deployed stack to its EnableTerminationProtection,
+// which change sets do not carry. Nothing is updated when the field is unset or already matches the stack
+func applyTerminationProtection(cfn *cloudformation.Client, stack internal.Stack) {
+	if stack.EnableTerminationProtection == nil {
+		return
+	}
+	describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)})
+	if describeStacksErr != nil {
+		log.Error(describeStacksErr)
+		return
+	}
+	if aws.ToBool(describeStacksOutput.Stacks[0].EnableTerminationProtection) == *stack.EnableTerminationProtection {
+		return
+	}
+
+	log.Infof("%s", au.Gray(11, fmt.Sprintf("  Setting termination protection to %t...", *stack.EnableTerminationProtection)))
+	_, updateTerminationProtectionErr := cfn.UpdateTerminationProtection(ctx, &cloudformation.UpdateTerminationProtectionInput{
+		StackName:                   aws.String(stack.Name),
+		EnableTerminationProtection: stack.EnableTerminationProtection,
+	})
+	if updateTerminationProtectionErr != nil {
+		log.X()
+		log.Error(updateTerminationProtectionErr)
+		return
+	}
+	log.Check()
+}
+
+// getParameters returns the change set parameters of the stack, either loaded from its overrides or using previous values
+func getParameters(stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) ([]types.Parameter, error) {
+	stackParametersValue := stackValue.LookupPath(cue.ParsePath("Template.Parameters"))
+	if !stackParametersValue.Exists() {
+		return nil, nil
+	}
+
+	// TODO paramaters need to support the type as declared in Parameter.Type (in the least string and number).
+	// this should be map[string]interface{} with type casting done when adding parameters to the changeset
+	parametersMap := make(map[string]string)
+	var parameters []types.Parameter
+
+	if flags.DeployPrevious {
+		// deploy using previous values
+		stackParameters, stackParametersErr := stackParametersValue.Fields()
+		if stackParametersErr != nil {
+			return nil, stackParametersErr
+		}
+		log.Infof("%s", au.Gray(11, "  Using previous parameters..."))
+		for stackParameters.Next() {
+			stackParam := stackParameters.Value()
+			key, _ := stackParam.Label()
+			parametersMap[key] = ""
+		}
+		log.Check()
+	} else {
+		// load overrides
+
+		// TODO #48 stax should prompt for each Parameter input if overrides are undefined
+		if len(stack.Overrides) < 1 {
+			return nil, errors.New("Template has Parameters but no Overrides are defined.")
+		}
+
+		for k, v := range stack.Overrides {
+			behavior := v
+
+			source, sourceErr := internal.NewOverrideSource(k, behavior, stack, buildInstance)
+			if sourceErr != nil {
+				return nil, sourceErr
+			}
+
+			log.Infof("%s", au.Gray(11, "  Applying overrides: "+strings.Replace(source.String(), buildInstance.Root+"/", "", 1)+" "))
+
+			// TODO #47 parameters need to support the type as declared in Parameter.Type (in the least string and number).
+			// this should be map[string]interface{} with type casting done when adding parameters to the changeset
+			override, overrideErr := source.Load(ctx)
+			if overrideErr != nil {
+				return nil, overrideErr
+			}
+			if behavior.SourceName() != internal.OverrideFile && !behavior.Reference {
+				for _, value := range override {
+					log.AddSecrets(value)
+				}
+			}
+
+			// TODO #50 stax should error when a parameter key is duplicated among two or more overrides files
+			applyOverride(parametersMap, behavior, override)
+			log.Check()
+		}
+	}
+
+	if !flags.DeployPrevious {
+		unsetErr := checkNoEchoParameters(stackParametersValue, parametersMap)
+		if unsetErr != nil {
+			return nil, unsetErr
+		}
+	}
+
+	// apply parameters to changeset
+	for k, v := range parametersMap {
+		paramKey := k
+		paramVal := v
+		parameter := types.Parameter{ParameterKey: aws.String(paramKey)}
+
+		if isNoEchoParameter(stackParametersValue, paramKey) {
+			log.AddSecrets(paramVal)
+		}
+
+		if flags.DeployPrevious {
+			parameter.UsePreviousValue = aws.Bool(true)
+		} else {
+			parameter.ParameterValue = aws.String(paramVal)
+		}
+
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters, nil
+}
+
+// applyOverride sets the parameters of the values loaded from an override, renamed by its Map if any
+func applyOverride(parametersMap map[string]string, behavior internal.Override, override map[string]string) {
+	if len(behavior.Map) > 0 {
+		// map the yaml key:value to parameter key:value
+		for k, v := range behavior.Map {
+			fromKey := k
+			toKey := v
+			parametersMap[toKey] = override[fromKey]
+		}
+	} else {
+		// just do a straight copy, keys should align 1:1
+		for k, v := range override {
+			overrideKey := k
+			overrideVal := v
+			parametersMap[overrideKey] = overrideVal
+		}
+	}
+}
+
+// isNoEchoParameter returns true if the template parameter is NoEcho
+func isNoEchoParameter(stackParametersValue cue.Value, paramKey string) bool {
+	noEcho := stackParametersValue.LookupPath(cue.MakePath(cue.Str(paramKey), cue.Str("NoEcho")))
+	if isNoEcho, _ := noEcho.Bool(); isNoEcho {
+		return true
+	}
+	isNoEcho, _ := noEcho.String()
+	return isNoEcho == "true"
+}
+
+// checkNoEchoParameters returns an error for NoEcho parameters without a Default that are not set, or that are set
+// to the mask CloudFormation returns in place of their value, as left by import
+func checkNoEchoParameters(stackParametersValue cue.Value, parametersMap map[string]string) error {
+	stackParameters, stackParametersErr := stackParametersValue.Fields()
+	if stackParametersErr != nil {
+		return stackParametersErr
+	}
+	for stackParameters.Next() {
+		paramKey := stackParameters.Label()
+		if !isNoEchoParameter(stackParametersValue, paramKey) {
+			continue
+		}
+		paramVal, isSet := parametersMap[paramKey]
+		if paramVal == internal.NoEchoMask {
+			return fmt.Errorf("NoEcho parameter %s is set to %s, set its value in the overrides", paramKey, internal.NoEchoMask)
+		}
+		if !isSet && !stackParameters.Value().LookupPath(cue.ParsePath("Default")).Exists() {
+			return fmt.Errorf("NoEcho parameter %s has no value, set it in the overrides", paramKey)
+		}
+	}
+	return nil
+}
+
+// getTags returns the change set tags of the stack
+func getTags(stack internal.Stack, buildInstance *build.Instance) []types.Tag {
+	if len(stack.Tags) < 1 || !stack.TagsEnabled {
+		return nil
+	}
+
+	var tags []types.Tag
+	for k, v := range stack.Tags {
+		tagK := k // reassign here to avoid issues with for-scope var
+		var tagV string
+		switch v {
+		default:
+			tagV = v
+		case "${STX::CuePath}":
+			tagV = strings.Replace(buildInstance.Dir, buildInstance.Root, "", 1)
+		}
+		tags = append(tags, types.Tag{Key: &tagK, Value: &tagV})
+	}
+	return tags
+}
+
+// maskParameters returns a copy of parameters without their values, for logging
+func maskParameters(parameters []types.Parameter) []types.Parameter {
+	masked := make([]types.Parameter, len(parameters))
+	for i, parameter := range parameters {
+		masked[i] = parameter
+		if parameter.ParameterValue != nil {
+			masked[i].ParameterValue = aws.String("****")
+		}
+		masked[i].ResolvedValue = nil
+	}
+	return masked
+}
+
+// offerDeleteChangeSet asks, once interrupted, whether to delete the change set left pending
+func offerDeleteChangeSet(cfn *cloudformation.Client, stackName, changeSetName string) {
+	log.SkipStack("interrupted")
+	log.Infof("%s %s %s\n", au.Index(255-88, "Delete pending change set"), au.BrightBlue(changeSetName), au.Index(255-88, "?"))
+	log.Infof("%s\n%s", au.Gray(11, "Y to delete. Anything else to keep it."), au.Gray(11, "▶︎"))
+	if !confirm(context.Background()) {
+		return
+	}
+
+	log.Infof("%s %s\n", au.White("Deleting"), au.BrightBlue(changeSetName))
+	deleteChangesetInput := cloudformation.DeleteChangeSetInput{ChangeSetName: aws.String(changeSetName), StackName: aws.String(stackName)}
+	_, deleteChangeSetErr := cfn.DeleteChangeSet(context.Background(), &deleteChangesetInput)
+	if deleteChangeSetErr != nil {
+		log.Error(deleteChangeSetErr)
+	}
+}
+
+// offerCancelUpdate asks, once interrupted, whether to cancel the update in progress, which rolls the stack back.
+// Other operations cannot be cancelled and keep running
+func offerCancelUpdate(cfn *cloudformation.Client, stackName string, stackStatus types.StackStatus) {
+	log.SkipStack("interrupted")
+	if stackStatus != types.StackStatusUpdateInProgress {
+		log.Warnf("%s keeps deploying, follow it with stax events\n", stackName)
+		return
+	}
+
+	log.Infof("%s %s %s\n", au.Index(255-88, "Cancel the update of"), au.Magenta(stackName), au.Index(255-88, "?"))
+	log.Infof("%s\n%s", au.Gray(11, "Y to cancel and roll back. Anything else to let it complete."), au.Gray(11, "▶︎"))
+	if !confirm(context.Background()) {
+		log.Warnf("%s keeps deploying, follow it with stax events\n", stackName)
+		return
+	}
+
+	log.Infof("%s %s\n", au.White("Cancelling update of"), au.Magenta(stackName))
+	_, cancelUpdateStackErr := cfn.CancelUpdateStack(context.Background(), &cloudformation.CancelUpdateStackInput{StackName: aws.String(stackName)})
+	if cancelUpdateStackErr != nil {
+		log.Error(cancelUpdateStackErr)
+	}
+}
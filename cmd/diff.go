@@ -1,19 +1,27 @@
 package cmd
 
 import (
-	"context"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"regexp"
+	"path"
+	"sort"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/build"
+	cueYaml "cuelang.org/go/pkg/encoding/yaml"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/cue-sh/stax/internal"
+	"github.com/cue-sh/stax/logger"
 	"github.com/gonvenience/ytbx"
 	"github.com/homeport/dyff/pkg/dyff"
 	"github.com/spf13/cobra"
+	goYaml "gopkg.in/yaml.v2"
 )
 
 // exeCmd represents the exe command
@@ -27,15 +35,50 @@ in CloudFormation, then produce a rich, functional, property-based diff (not
 text-based) against the two templates.
 
 Diff is an implementation of https://github.com/homeport/dyff
+
+To gate CI on drift between Cue and CloudFormation:
+
+--exit-code exits with code 6 when any selected stack differs or does not exist yet.
+--summary lists only the changed stacks with counts of added, removed and
+modified paths instead of the full report.
+--ignore excludes template paths from the comparison. Paths are dot-separated
+and each element may be a glob, e.g.: --ignore Metadata,Resources.*.Metadata
+
+Parameters are compared with the values of file overrides, the references of
+Reference overrides and the template defaults. Secrets are never read to diff:
+parameters set by sops, ssm or secretsmanager overrides are compared as
+deployed.
+
+With --against <git-ref>, diff does not use AWS at all. Instead the same cue
+instances are evaluated at the given revision (checked out in a temporary git
+worktree), with the config.stax.cue files of that revision, and each stack is
+compared locally: its #Stack settings, the contents of its overrides files,
+and its rendered template. This shows the
+real CloudFormation impact of a Cue refactor, e.g. in a pull request:
+
+stax diff --against origin/main --summary
+
+Overrides encrypted with sops are compared by checksum since they are not
+decrypted.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		defer log.Flush()
 
+		changedStacks := 0
+
+		if flags.DiffAgainst != "" {
+			changedStacks = diffAgainst(args)
+			if flags.DiffExitCode && changedStacks > 0 {
+				log.SetExitCode(logger.ExitDiff)
+			}
+			return
+		}
+
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -45,11 +88,11 @@ Diff is an implementation of https://github.com/homeport/dyff
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
 
-				fileName, saveErr := saveStackAsYml(stack, buildInstance, stackValue)
+				fileName, saveErr := saveStackAsYml(dirConfig, stack, buildInstance, stackValue)
 				if saveErr != nil {
 					log.Error(saveErr)
 				}
@@ -63,55 +106,513 @@ Diff is an implementation of https://github.com/homeport/dyff
 
 				// look to see if stack exists
 				describeStacksInput := cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)}
-				describeStacksOutput, describeStacksErr := cfn.DescribeStacks(context.TODO(), &describeStacksInput)
+				describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &describeStacksInput)
 
 				if describeStacksErr != nil {
 					log.Debugf("DESC STAX:\n%+v\n", describeStacksOutput)
-					log.Error(describeStacksErr)
+					if !internal.IsStackNotFound(describeStacksErr) {
+						log.Error(describeStacksErr)
+						continue
+					}
+					changedStacks++
+					if flags.DiffSummary {
+						log.Infof("%s %s\n", au.Magenta(stack.Name), au.Green("new stack"))
+					} else {
+						log.Warn(stack.Name + " does not exist yet.")
+					}
+					continue
+				}
+
+				// build what deploy would send so stack settings can be compared alongside the template
+				changeSetInput := cloudformation.CreateChangeSetInput{
+					StackName:        aws.String(stack.Name),
+					TemplateBody:     aws.String(templateBody),
+					Tags:             getTags(stack, buildInstance),
+					NotificationARNs: stack.NotificationARNs,
+				}
+				if stack.Role != "" {
+					changeSetInput.RoleARN = aws.String(stack.Role)
+				}
+
+				parameters, unresolved, parametersErr := getDiffParameters(stack, buildInstance, stackValue)
+				if parametersErr != nil {
+					log.Error(internal.StackError(parametersErr, buildInstance, stackValue))
+					continue
+				}
+				changeSetInput.Parameters = parameters
+
+				validateTemplateOutput, validateTemplateErr := cfn.ValidateTemplate(ctx, &cloudformation.ValidateTemplateInput{TemplateBody: aws.String(templateBody)})
+				if validateTemplateErr != nil {
+					log.Error(validateTemplateErr)
 					continue
 				}
+				changeSetInput.Capabilities = validateTemplateOutput.Capabilities
 
-				diff(cfn, stack.Name, templateBody)
+				if diff(cfn, &changeSetInput, stackValue, unresolved) {
+					changedStacks++
+				}
 			}
 
 		})
+
+		if flags.DiffExitCode && changedStacks > 0 {
+			log.SetExitCode(logger.ExitDiff)
+		}
 	},
 }
 
-func diff(cfn *cloudformation.Client, stackName, templateBody string) {
-	existingTemplate, err := cfn.GetTemplate(context.TODO(), &cloudformation.GetTemplateInput{
+// getDiffParameters returns the parameters diff compares without reading secrets: the values of file overrides and
+// the references passed by Reference overrides. unresolved is true when the stack has secret sources, whose
+// parameters are then compared as deployed. A stack that only uses template defaults has no parameters
+func getDiffParameters(stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) (parameters []types.Parameter, unresolved bool, err error) {
+	if !stackValue.LookupPath(cue.ParsePath("Template.Parameters")).Exists() {
+		return nil, false, nil
+	}
+
+	parametersMap := make(map[string]string)
+	for key, override := range stack.Overrides {
+		if override.SourceName() != internal.OverrideFile && !override.Reference {
+			unresolved = true
+			continue
+		}
+		source, sourceErr := internal.NewOverrideSource(key, override, stack, buildInstance)
+		if sourceErr != nil {
+			return nil, false, sourceErr
+		}
+		values, loadErr := source.Load(ctx)
+		if loadErr != nil {
+			return nil, false, loadErr
+		}
+		applyOverride(parametersMap, override, values)
+	}
+
+	for key, value := range parametersMap {
+		parameters = append(parameters, types.Parameter{ParameterKey: aws.String(key), ParameterValue: aws.String(value)})
+	}
+	return parameters, unresolved, nil
+}
+
+// diff compares the stack stored in CloudFormation with what the change set input would deploy and prints
+// the differences of its settings and template, either as a full report or as a --summary. returns true if they differ.
+// With unresolved, parameters missing from the change set input are compared as deployed
+func diff(cfn *cloudformation.Client, changeSetInput *cloudformation.CreateChangeSetInput, stackValue cue.Value, unresolved bool) bool {
+	stackName := aws.ToString(changeSetInput.StackName)
+
+	describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: changeSetInput.StackName})
+	if describeStacksErr != nil {
+		log.Error("Error describing stack", stackName)
+		return false
+	}
+
+	existingTemplate, err := cfn.GetTemplate(ctx, &cloudformation.GetTemplateInput{
 		StackName: &stackName,
 	})
 	if err != nil {
 		log.Error("Error getting template for stack", stackName)
-	} else {
-		r, _ := regexp.Compile("!(Base64|Cidr|FindInMap|GetAtt|GetAZs|ImportValue|Join|Select|Split|Sub|Transform|Ref|And|Equals|If|Not|Or)")
-		if r.MatchString(aws.ToString(existingTemplate.TemplateBody)) {
-			log.Warn("The existing stack uses short intrinsic functions, unable to create diff: " + stackName)
-		} else {
-			existingDoc, _ := ytbx.LoadDocuments([]byte(aws.ToString(existingTemplate.TemplateBody)))
-			doc, _ := ytbx.LoadDocuments([]byte(templateBody))
-			report, err := dyff.CompareInputFiles(
-				ytbx.InputFile{Documents: existingDoc},
-				ytbx.InputFile{Documents: doc},
-			)
-			if err != nil {
-				log.Error("Error creating template diff for stack: " + stackName)
-			} else {
-				if len(report.Diffs) > 0 {
-					reportWriter := &dyff.HumanReport{
-						Report:     report,
-						ShowBanner: false,
+		return false
+	}
+
+	// templates authored in yml may use short form intrinsic functions (!Ref, !Sub...) that must be
+	// expanded into their long form to be comparable with the exported template
+	existingTemplateBody, expandErr := internal.ExpandShortIntrinsics([]byte(aws.ToString(existingTemplate.TemplateBody)))
+	if expandErr != nil {
+		log.Errorf("Unable to parse the existing template of %s, cannot create diff: %s\n", stackName, expandErr)
+		return false
+	}
+
+	templateReport, err := compareYml(existingTemplateBody, []byte(aws.ToString(changeSetInput.TemplateBody)))
+	if err != nil {
+		log.Error("Error creating template diff for stack: " + stackName)
+		return false
+	}
+	templateReport.Diffs = ignoreDiffs(templateReport.Diffs, flags.DiffIgnore)
+
+	deployedStack := describeStacksOutput.Stacks[0]
+	deployedSettings := newStackSettings(deployedStack.Parameters, deployedStack.Tags, deployedStack.RoleARN, deployedStack.Capabilities, deployedStack.NotificationARNs)
+	settings := newStackSettings(changeSetInput.Parameters, changeSetInput.Tags, changeSetInput.RoleARN, changeSetInput.Capabilities, changeSetInput.NotificationARNs)
+	settings.resolveParameters(deployedSettings, stackValue, unresolved)
+
+	// CloudFormation keeps the current tags, role and notification arns when a change set does not specify them
+	if changeSetInput.Tags == nil {
+		settings.Tags = deployedSettings.Tags
+	}
+	if changeSetInput.RoleARN == nil {
+		settings.RoleARN = deployedSettings.RoleARN
+	}
+	if changeSetInput.NotificationARNs == nil {
+		settings.NotificationARNs = deployedSettings.NotificationARNs
+	}
+
+	deployedSettingsYml, _ := goYaml.Marshal(deployedSettings)
+	settingsYml, _ := goYaml.Marshal(settings)
+	settingsReport, err := compareYml(deployedSettingsYml, settingsYml)
+	if err != nil {
+		log.Error("Error creating stack settings diff for stack: " + stackName)
+		return false
+	}
+
+	return printDiff(stackName, diffSection{title: "Stack settings", report: settingsReport}, diffSection{title: "Template", report: templateReport})
+}
+
+// stackSettings holds the values outside of the template that trigger a deployment when changed
+type stackSettings struct {
+	Parameters       map[string]string `yaml:"Parameters"`
+	Tags             map[string]string `yaml:"Tags"`
+	RoleARN          string            `yaml:"RoleARN"`
+	Capabilities     []string          `yaml:"Capabilities"`
+	NotificationARNs []string          `yaml:"NotificationARNs"`
+}
+
+func newStackSettings(parameters []types.Parameter, tags []types.Tag, roleARN *string, capabilities []types.Capability, notificationARNs []string) *stackSettings {
+	settings := stackSettings{
+		Parameters:       make(map[string]string),
+		Tags:             make(map[string]string),
+		RoleARN:          aws.ToString(roleARN),
+		NotificationARNs: append([]string{}, notificationARNs...),
+	}
+	for _, parameter := range parameters {
+		if aws.ToBool(parameter.UsePreviousValue) {
+			// resolved against the deployed value
+			continue
+		}
+		settings.Parameters[aws.ToString(parameter.ParameterKey)] = aws.ToString(parameter.ParameterValue)
+	}
+	for _, tag := range tags {
+		settings.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for _, capability := range capabilities {
+		settings.Capabilities = append(settings.Capabilities, string(capability))
+	}
+	sort.Strings(settings.Capabilities)
+	sort.Strings(settings.NotificationARNs)
+	return &settings
+}
+
+// resolveParameters fills in the parameters that CloudFormation would resolve on its own: previous values
+// and template defaults. With unresolved, parameters that are not set take their deployed value since they come from
+// sources that were not read. NoEcho parameters are masked as CloudFormation does
+func (settings *stackSettings) resolveParameters(deployed *stackSettings, stackValue cue.Value, unresolved bool) {
+	parameters, parametersErr := stackValue.LookupPath(cue.ParsePath("Template.Parameters")).Fields()
+	if parametersErr != nil {
+		return
+	}
+	for parameters.Next() {
+		key, _ := parameters.Value().Label()
+
+		if _, ok := settings.Parameters[key]; !ok {
+			if deployedValue, ok := deployed.Parameters[key]; ok && (flags.DeployPrevious || unresolved) {
+				settings.Parameters[key] = deployedValue
+			} else if defaultValue := parameters.Value().LookupPath(cue.ParsePath("Default")); defaultValue.Exists() {
+				var value interface{}
+				if defaultValue.Decode(&value) == nil {
+					settings.Parameters[key] = fmt.Sprint(value)
+				}
+			}
+		}
+
+		noEcho := parameters.Value().LookupPath(cue.ParsePath("NoEcho"))
+		if isNoEcho, _ := noEcho.Bool(); isNoEcho {
+			settings.Parameters[key] = "****"
+		} else if isNoEcho, _ := noEcho.String(); isNoEcho == "true" {
+			settings.Parameters[key] = "****"
+		}
+	}
+}
+
+// diffSection is a titled report printed as part of a stack's diff
+type diffSection struct {
+	title  string
+	report dyff.Report
+}
+
+// compareYml returns the property-based differences between the from and to yml documents
+func compareYml(from, to []byte) (dyff.Report, error) {
+	fromDoc, fromErr := ytbx.LoadDocuments(from)
+	if fromErr != nil {
+		return dyff.Report{}, fromErr
+	}
+	toDoc, toErr := ytbx.LoadDocuments(to)
+	if toErr != nil {
+		return dyff.Report{}, toErr
+	}
+	return dyff.CompareInputFiles(
+		ytbx.InputFile{Documents: fromDoc},
+		ytbx.InputFile{Documents: toDoc},
+	)
+}
+
+// printDiff prints the sections that have differences, either as a full report or as a --summary.
+// returns true if any section differs
+func printDiff(stackName string, sections ...diffSection) bool {
+	var added, removed, modified int
+	for _, section := range sections {
+		for _, d := range section.report.Diffs {
+			for _, detail := range d.Details {
+				switch detail.Kind {
+				case dyff.ADDITION:
+					added++
+				case dyff.REMOVAL:
+					removed++
+				default:
+					modified++
+				}
+			}
+		}
+	}
+
+	if added+removed+modified < 1 {
+		return false
+	}
+
+	if flags.DiffSummary {
+		log.Infof("%s %s %s %s\n", au.Magenta(stackName), au.Green(fmt.Sprintf("+%d", added)), au.Red(fmt.Sprintf("-%d", removed)), au.Yellow(fmt.Sprintf("±%d", modified)))
+		return true
+	}
+
+	for _, section := range sections {
+		if len(section.report.Diffs) < 1 {
+			continue
+		}
+		if section.title != "" {
+			log.Infof("%s %s\n", au.Magenta(stackName), au.White(section.title))
+		}
+		reportWriter := &dyff.HumanReport{
+			Report:     section.report,
+			ShowBanner: false,
+		}
+		var reportBuffer bytes.Buffer
+		reportWriter.WriteReport(&reportBuffer)
+		log.Infof("%s", reportBuffer.String())
+	}
+	return true
+}
+
+// renderedStack holds the yml documents of a stack that are compared by diff --against
+type renderedStack struct {
+	settings, overrides, template []byte
+}
+
+// diffAgainst compares the stacks as evaluated at the --against git revision with the working tree.
+// returns the number of stacks that differ
+func diffAgainst(args []string) int {
+	workingDir, workingDirErr := os.Getwd()
+	if workingDirErr != nil {
+		log.Fatal(workingDirErr)
+		return 0
+	}
+
+	log.Infof("%s %s...", au.White("Checking out"), au.BrightBlue(flags.DiffAgainst))
+	worktree, worktreeErr := internal.NewGitWorktree(config.CueRoot, flags.DiffAgainst)
+	if worktreeErr != nil {
+		log.X()
+		log.Fatal(worktreeErr)
+		return 0
+	}
+	defer func() {
+		removeErr := worktree.Remove()
+		if removeErr != nil {
+			log.Error(removeErr)
+		}
+	}()
+	log.Check()
+
+	worktreeWorkingDir, worktreeWorkingDirErr := worktree.Path(workingDir)
+	if worktreeWorkingDirErr != nil {
+		log.Fatal(worktreeWorkingDirErr)
+		return 0
+	}
+
+	// the revision is evaluated with its own config.stax.cue files
+	againstConfig, againstConfigErr := internal.LoadConfigIn(worktreeWorkingDir, flags, log)
+	if againstConfigErr != nil {
+		log.Fatal(strings.Join(internal.ErrorMessages(againstConfigErr), "\n"))
+		return 0
+	}
+
+	log.Debug("Rendering stacks at", flags.DiffAgainst)
+	againstStacks := renderStacks(againstConfig, worktreeWorkingDir, args)
+	log.Debug("Rendering stacks in working tree")
+	currentStacks := renderStacks(config, "", args)
+
+	var stackNames []string
+	for stackName := range currentStacks {
+		stackNames = append(stackNames, stackName)
+	}
+	for stackName := range againstStacks {
+		if _, ok := currentStacks[stackName]; !ok {
+			stackNames = append(stackNames, stackName)
+		}
+	}
+	sort.Strings(stackNames)
+
+	changedStacks := 0
+	for _, stackName := range stackNames {
+		against, inAgainst := againstStacks[stackName]
+		current, inCurrent := currentStacks[stackName]
+
+		if !inAgainst {
+			changedStacks++
+			log.Infof("%s %s\n", au.Magenta(stackName), au.Green("new stack"))
+			continue
+		}
+		if !inCurrent {
+			changedStacks++
+			log.Infof("%s %s\n", au.Magenta(stackName), au.Red("removed stack"))
+			continue
+		}
+
+		var sections []diffSection
+		for _, document := range []struct {
+			title    string
+			from, to []byte
+			ignore   []string
+		}{
+			{"Stack settings", against.settings, current.settings, nil},
+			{"Overrides", against.overrides, current.overrides, nil},
+			{"Template", against.template, current.template, flags.DiffIgnore},
+		} {
+			report, compareErr := compareYml(document.from, document.to)
+			if compareErr != nil {
+				log.Errorf("Error creating %s diff for stack %s: %s\n", document.title, stackName, compareErr)
+				continue
+			}
+			report.Diffs = ignoreDiffs(report.Diffs, document.ignore)
+			sections = append(sections, diffSection{title: document.title, report: report})
+		}
+
+		if printDiff(stackName, sections...) {
+			changedStacks++
+		}
+	}
+
+	return changedStacks
+}
+
+// renderStacks evaluates the cue instances found by args relative to dir with rootConfig, the config of the cue root
+// dir belongs to, and renders every stack without AWS
+func renderStacks(rootConfig *internal.Config, dir string, args []string) map[string]renderedStack {
+	renderedStacks := make(map[string]renderedStack)
+	buildInstances := internal.GetBuildInstancesIn(dir, args, rootConfig.PackageName)
+
+	internal.Process(rootConfig, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+		stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
+		if stacksIteratorErr != nil {
+			log.Fatal(stacksIteratorErr)
+		}
+
+		for stacksIterator.Next() {
+			stackValue := stacksIterator.Value()
+			var stack internal.Stack
+			decodeErr := stackValue.Decode(&stack)
+			if decodeErr != nil {
+				log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
+				continue
+			}
+
+			template, templateErr := cueYaml.Marshal(stackValue.LookupPath(cue.ParsePath("Template")))
+			if templateErr != nil {
+				log.Error(internal.StackError(templateErr, buildInstance, stackValue))
+				continue
+			}
+
+			var settings map[string]interface{}
+			settingsErr := stackValue.Decode(&settings)
+			if settingsErr != nil {
+				log.Error(internal.StackError(settingsErr, buildInstance, stackValue))
+				continue
+			}
+			delete(settings, "Template")
+			settingsYml, settingsYmlErr := goYaml.Marshal(settings)
+			if settingsYmlErr != nil {
+				log.Error(settingsYmlErr)
+				continue
+			}
+
+			// overrides are keyed by their path relative to the cue root so both revisions line up
+			overrides := make(map[string]interface{})
+			// secret sources are described rather than loaded, sops files by the hash of their ciphertext
+			for key, override := range stack.Overrides {
+				source, sourceErr := internal.NewOverrideSource(key, override, stack, buildInstance)
+				if sourceErr != nil {
+					log.Error(internal.StackError(sourceErr, buildInstance, stackValue))
+					continue
+				}
+				relativePath := strings.Replace(source.String(), buildInstance.Root+"/", "", 1)
+
+				switch override.SourceName() {
+				case internal.OverrideFile:
+					overrideValue, loadErr := source.Load(ctx)
+					if loadErr != nil {
+						log.Error(loadErr)
+						continue
 					}
-					reportWriter.WriteReport(os.Stdout)
+					overrides[relativePath] = overrideValue
+				case internal.OverrideSops:
+					path := internal.ResolveOverridePath(key, buildInstance)
+					overrideBytes, readErr := ioutil.ReadFile(path)
+					if readErr != nil {
+						log.Error(readErr)
+						continue
+					}
+					overrides[relativePath] = fmt.Sprintf("sops encrypted, sha1: %x", sha1.Sum(overrideBytes))
+				default:
+					overrides[relativePath] = "resolved at deploy time"
+				}
+			}
+			overridesYml, overridesYmlErr := goYaml.Marshal(overrides)
+			if overridesYmlErr != nil {
+				log.Error(overridesYmlErr)
+				continue
+			}
+
+			renderedStacks[stack.Name] = renderedStack{settings: settingsYml, overrides: overridesYml, template: []byte(template)}
+		}
+	})
+
+	return renderedStacks
+}
+
+// ignoreDiffs removes the diffs whose path is at or below one of the dot-separated ignore paths.
+// each element of an ignore path may be a glob, e.g.: Resources.*.Metadata
+func ignoreDiffs(diffs []dyff.Diff, ignorePaths []string) []dyff.Diff {
+	if len(ignorePaths) < 1 {
+		return diffs
+	}
+
+	var kept []dyff.Diff
+	for _, d := range diffs {
+		diffPath := strings.Split(d.Path.ToDotStyle(), ".")
+		ignored := false
+		for _, ignorePath := range ignorePaths {
+			ignoreElements := strings.Split(ignorePath, ".")
+			if len(ignoreElements) > len(diffPath) {
+				continue
+			}
+			matched := true
+			for i, ignoreElement := range ignoreElements {
+				if ok, _ := path.Match(ignoreElement, diffPath[i]); !ok {
+					matched = false
+					break
 				}
 			}
+			if matched {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept = append(kept, d)
 		}
 	}
+	return kept
 }
 
 func init() {
 	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVar(&flags.DiffExitCode, "exit-code", false, "Exit non-zero when any stack differs or does not exist yet.")
+	diffCmd.Flags().BoolVar(&flags.DiffSummary, "summary", false, "Only list changed stacks with counts of added, removed and modified paths.")
+	diffCmd.Flags().StringVar(&flags.DiffAgainst, "against", "", "Compare locally against the stacks evaluated at this git revision instead of CloudFormation.")
+	diffCmd.Flags().StringSliceVar(&flags.DiffIgnore, "ignore", nil, "Comma-separated template paths to exclude from comparison. E.g.: Metadata,Resources.*.Metadata")
 
 	// TODO add a flag to watch events
 }
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"context"
-	"os"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -10,7 +8,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/cue-sh/stax/internal"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
@@ -27,8 +24,8 @@ For each stack, events will query CloudFormation and return a list of events.`,
 
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -38,7 +35,7 @@ For each stack, events will query CloudFormation and return a list of events.`,
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
 
@@ -46,7 +43,7 @@ For each stack, events will query CloudFormation and return a list of events.`,
 				// get a session and cloudformation service client
 				cfn := internal.GetCloudFormationClient(stack.Profile, stack.Region)
 				describeStackEventsInput := cloudformation.DescribeStackEventsInput{StackName: aws.String(stack.Name)}
-				describeStackEventsOutput, describeStackEventsErr := cfn.DescribeStackEvents(context.TODO(), &describeStackEventsInput)
+				describeStackEventsOutput, describeStackEventsErr := cfn.DescribeStackEvents(ctx, &describeStackEventsInput)
 				if describeStackEventsErr != nil {
 					log.Error(describeStackEventsErr)
 					continue
@@ -59,10 +56,7 @@ For each stack, events will query CloudFormation and return a list of events.`,
 					numberStacksToDisplay = len(describeStackEventsOutput.StackEvents)
 				}
 
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoWrapText(false)
-				table.SetHeader([]string{"Resource", "Status", "Time", "Reason"})
-				table.SetHeaderColor(tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor})
+				table := log.NewTable("Resource", "Status", "Time", "Reason")
 
 				for i, event := range describeStackEventsOutput.StackEvents {
 					if i >= numberStacksToDisplay {
@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/build"
 	"cuelang.org/go/pkg/encoding/yaml"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/cue-sh/stax/internal"
 	"github.com/spf13/cobra"
 )
@@ -21,7 +27,12 @@ var exportCmd = &cobra.Command{
 The following config.stax.cue options are avilable:
 
 Cmd: {
-  Export: YmlPath: string | *"./yml"
+  Export: {
+    YmlPath:      string | *"./yml"
+    Format:       *"yml" | "json"
+    PathTemplate: string | *"${STX::Profile}/${STX::Name}"
+    Parameters:   *"" | "cli" | "template-configuration"
+  }
 }
 
 The YmlPath is a path relative to the cue root. The cue root is the folder that
@@ -34,14 +45,73 @@ infrastructure/
 | ...
 |-yml/
 | |-cloudformation/
+
+The PathTemplate is the path of each exported file relative to YmlPath,
+without extension. It supports the following placeholders:
+${STX::Profile}, ${STX::Region}, ${STX::RegionCode}, ${STX::Environment},
+${STX::Name}, and ${STX::CuePath} (the stack's directory relative to the cue root).
+For example: "${STX::Environment}/${STX::Region}/${STX::Name}"
+
+Templates are written as .cfn.yml or, with Format: "json", as .cfn.json.
+Use --stdout to print the templates instead of writing files, logs then go to
+stderr.
+
+Parameters writes a companion file holding the stack's parameter values as
+loaded from its overrides, next to the template:
+  cli                     <name>.parameters.json as [{ParameterKey, ParameterValue}]
+                          for aws cloudformation --parameters file://...
+  template-configuration  <name>.config.json as {Parameters, Tags}
+                          for CodePipeline's TemplateConfiguration
+Beware that parameter files contain decrypted sops values.
+
+--format and --parameters override the config for a single run.
+
+Export keeps track of the files it generates in a .stax-manifest.json file in
+each YmlPath it exports to, as resolved by the config of the stack's directory.
+Files of stacks that were renamed or removed from Cue are reported as
+stale, and --prune deletes them. --check writes nothing and instead fails if
+any exported template is missing, out of date, or stale, e.g. to verify in CI
+that committed templates match Cue. Stale files can only be detected when
+every stack is evaluated: from the cue root, without args or filters.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		defer log.Flush()
 
+		// keep stdout for the templates
+		if flags.ExportStdout {
+			log.UseStderr()
+		}
+
+		rootConfig := applyExportFlags(config)
+		if rootConfig.Cmd.Export.Format != "yml" && rootConfig.Cmd.Export.Format != "json" {
+			log.Fatalf("Unknown export format %s\n", rootConfig.Cmd.Export.Format)
+			return
+		}
+
+		evaluatesAll := evaluatesAllStacks(args)
+		if flags.ExportPrune && !evaluatesAll {
+			log.Fatal("--prune requires every stack to be evaluated: run it from the cue root without args or filters.")
+			return
+		}
+
+		// files generated by this run, by the YmlPath of the config they were exported with, each YmlPath keeping
+		// its own manifest
+		generated := map[string]map[string]bool{exportYmlPath(rootConfig): {}}
+		markGenerated := func(exportConfig *internal.Config, fileName string) {
+			ymlPath := exportYmlPath(exportConfig)
+			if generated[ymlPath] == nil {
+				generated[ymlPath] = make(map[string]bool)
+			}
+			generated[ymlPath][manifestPath(ymlPath, fileName)] = true
+		}
+
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			// flags take precedence over the config of the instance's directory
+			exportConfig := applyExportFlags(dirConfig)
+
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -51,36 +121,356 @@ infrastructure/
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
+					continue
+				}
+
+				if flags.ExportCheck {
+					fileName, checkErr := checkStackTemplate(exportConfig, stack, buildInstance, stackValue)
+					if checkErr != nil {
+						log.Error(internal.StackError(checkErr, buildInstance, stackValue))
+					}
+					if fileName != "" {
+						markGenerated(exportConfig, fileName)
+					}
+					// parameters files are generated along with the template, they are not stale
+					if parametersFileName := internal.GetStackArtifacts(exportConfig, stack, buildInstance).Parameters; parametersFileName != "" {
+						markGenerated(exportConfig, parametersFileName)
+					}
 					continue
 				}
-				_, saveErr := saveStackAsYml(stack, buildInstance, stackValue)
+
+				fileName, saveErr := saveStackAsYml(exportConfig, stack, buildInstance, stackValue)
 				if saveErr != nil {
-					log.Error(saveErr)
+					log.Error(internal.StackError(saveErr, buildInstance, stackValue))
+					continue
+				}
+				if fileName != "" {
+					markGenerated(exportConfig, fileName)
+				}
+
+				if exportConfig.Cmd.Export.Parameters != "" && !flags.ExportStdout {
+					parametersFileName, parametersErr := saveStackParameters(exportConfig, stack, buildInstance, stackValue)
+					if parametersErr != nil {
+						log.Error(internal.StackError(parametersErr, buildInstance, stackValue))
+						continue
+					}
+					markGenerated(exportConfig, parametersFileName)
 				}
 			}
 		})
+
+		if flags.ExportStdout {
+			return
+		}
+
+		var ymlPaths []string
+		for ymlPath := range generated {
+			ymlPaths = append(ymlPaths, ymlPath)
+		}
+		sort.Strings(ymlPaths)
+		for _, ymlPath := range ymlPaths {
+			updateExportManifest(ymlPath, generated[ymlPath], evaluatesAll)
+		}
+		if flags.ExportCheck && log.NumErrors() == 0 {
+			log.Infof("%s %s\n", au.White("Exported files are up to date"), au.Green("✓"))
+		}
 	},
 }
 
-func saveStackAsYml(stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) (string, error) {
-	dir := filepath.Clean(config.CueRoot + "/" + config.Cmd.Export.YmlPath + "/" + stack.Profile)
-	os.MkdirAll(dir, 0755)
+// updateExportManifest reports or prunes the files of the manifest in ymlPath that were not generated by this run,
+// then records the generated files in it. With --check, nothing is written
+func updateExportManifest(ymlPath string, generated map[string]bool, evaluatesAll bool) {
+	manifest, manifestErr := readExportManifest(ymlPath)
+	if manifestErr != nil {
+		log.Fatal(manifestErr)
+		return
+	}
 
-	fileName := dir + "/" + stack.Name + ".cfn.yml"
-	log.Infof("%s %s %s %s\n", au.White("Exported"), au.Magenta(stack.Name), au.White("⤏"), fileName)
+	// files in the manifest that were not generated by this run are stale,
+	// but only when every stack was evaluated can that be known for sure
+	var stale []string
+	for _, file := range manifest.Files {
+		if !generated[file] && evaluatesAll {
+			stale = append(stale, file)
+		}
+	}
+
+	if flags.ExportCheck {
+		for _, file := range stale {
+			log.Errorf("%s %s\n", filepath.Join(ymlPath, file), "is no longer generated by any stack.")
+		}
+		return
+	}
+
+	// keep the files of stacks that were not evaluated by this run
+	files := make(map[string]bool)
+	for _, file := range manifest.Files {
+		files[file] = true
+	}
+	for file := range generated {
+		files[file] = true
+	}
+
+	if flags.ExportPrune {
+		for _, file := range stale {
+			// entries outside of ymlPath were recorded by older versions, they are not stax's to remove
+			if strings.HasPrefix(file, "../") || filepath.IsAbs(file) {
+				log.Warnf("%s is outside of %s and is not pruned.\n", file, ymlPath)
+				delete(files, file)
+				continue
+			}
+			removeErr := os.Remove(filepath.Join(ymlPath, file))
+			if removeErr != nil && !os.IsNotExist(removeErr) {
+				log.Error(removeErr)
+				continue
+			}
+			delete(files, file)
+			log.Infof("%s %s\n", au.White("Pruned →"), au.Gray(11, filepath.Join(ymlPath, file)))
+		}
+	} else if len(stale) > 0 {
+		log.Warnf("%d exported files in %s are no longer generated by any stack. Use --prune to remove them.\n", len(stale), ymlPath)
+	}
+
+	if len(files) == 0 && len(manifest.Files) == 0 {
+		return
+	}
+	manifest.Files = nil
+	for file := range files {
+		manifest.Files = append(manifest.Files, file)
+	}
+	writeErr := writeExportManifest(ymlPath, manifest)
+	if writeErr != nil {
+		log.Error(writeErr)
+	}
+}
+
+// exportYmlPath returns the directory exportConfig exports to, which holds its manifest
+func exportYmlPath(exportConfig *internal.Config) string {
+	return filepath.Clean(exportConfig.CueRoot + "/" + exportConfig.Cmd.Export.YmlPath)
+}
+
+// exportManifestFile is kept in YmlPath to track the files generated by export
+const exportManifestFile = ".stax-manifest.json"
+
+// exportManifest lists the files generated by export, relative to YmlPath
+type exportManifest struct {
+	Files []string
+}
+
+func readExportManifest(ymlPath string) (*exportManifest, error) {
+	var manifest exportManifest
+	manifestBytes, readErr := ioutil.ReadFile(filepath.Join(ymlPath, exportManifestFile))
+	if os.IsNotExist(readErr) {
+		return &manifest, nil
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	unmarshalErr := json.Unmarshal(manifestBytes, &manifest)
+	return &manifest, unmarshalErr
+}
+
+func writeExportManifest(ymlPath string, manifest *exportManifest) error {
+	sort.Strings(manifest.Files)
+	manifestBytes, marshalErr := json.MarshalIndent(manifest, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+	os.MkdirAll(ymlPath, 0755)
+	return ioutil.WriteFile(filepath.Join(ymlPath, exportManifestFile), append(manifestBytes, '\n'), 0644)
+}
+
+// dropFromExportManifest removes fileNames from the manifest in ymlPath, the manifest is left as is when it lists none
+// of them
+func dropFromExportManifest(ymlPath string, fileNames []string) error {
+	manifest, manifestErr := readExportManifest(ymlPath)
+	if manifestErr != nil {
+		return manifestErr
+	}
+
+	dropped := make(map[string]bool)
+	for _, fileName := range fileNames {
+		dropped[manifestPath(ymlPath, fileName)] = true
+	}
+	var files []string
+	for _, file := range manifest.Files {
+		if !dropped[file] {
+			files = append(files, file)
+		}
+	}
+	if len(files) == len(manifest.Files) {
+		return nil
+	}
+
+	manifest.Files = files
+	return writeExportManifest(ymlPath, manifest)
+}
+
+func manifestPath(ymlPath, fileName string) string {
+	relativePath, relErr := filepath.Rel(ymlPath, fileName)
+	if relErr != nil {
+		return fileName
+	}
+	return filepath.ToSlash(relativePath)
+}
+
+// checkStackTemplate returns an error if the exported template of the stack is missing or out of date
+func checkStackTemplate(exportConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) (string, error) {
+	body, extension, renderErr := renderStackTemplate(exportConfig, stackValue)
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	fileName := internal.GetStackArtifacts(exportConfig, stack, buildInstance).ExportPath + extension
+	existing, readErr := ioutil.ReadFile(fileName)
+	if os.IsNotExist(readErr) {
+		return fileName, fmt.Errorf("%s is missing, export %s", fileName, stack.Name)
+	}
+	if readErr != nil {
+		return fileName, readErr
+	}
+	if !bytes.Equal(existing, body) {
+		return fileName, fmt.Errorf("%s is out of date, export %s", fileName, stack.Name)
+	}
+	log.Debug(fileName, "is up to date")
+	return fileName, nil
+}
+
+// evaluatesAllStacks returns true if no args or filters limit the stacks evaluated from the cue root
+func evaluatesAllStacks(args []string) bool {
+	workingDir, _ := os.Getwd()
+	if len(args) > 0 || filepath.Clean(workingDir) != filepath.Clean(config.CueRoot) {
+		return false
+	}
+	return flags.Environment == "" && flags.Profile == "" && flags.RegionCode == "" && flags.Exclude == "" &&
+		flags.Include == "" && flags.StackNameRegexPattern == "" && flags.Has == ""
+}
+
+// applyExportFlags returns a copy of cfg with its export config overridden by --format and --parameters
+func applyExportFlags(cfg *internal.Config) *internal.Config {
+	exportConfig := *cfg
+	if flags.ExportFormat != "" {
+		exportConfig.Cmd.Export.Format = flags.ExportFormat
+	}
+	if flags.ExportParameters != "" {
+		exportConfig.Cmd.Export.Parameters = flags.ExportParameters
+	}
+	return &exportConfig
+}
+
+// renderStackTemplate returns the stack template as yml, or as json per Cmd.Export.Format, along with its file extension
+func renderStackTemplate(exportConfig *internal.Config, stackValue cue.Value) ([]byte, string, error) {
 	template := stackValue.LookupPath(cue.ParsePath("Template"))
+
+	if exportConfig.Cmd.Export.Format == "json" {
+		jsonBytes, jsonErr := template.MarshalJSON()
+		if jsonErr != nil {
+			return nil, "", jsonErr
+		}
+		var indented bytes.Buffer
+		indentErr := json.Indent(&indented, jsonBytes, "", "  ")
+		if indentErr != nil {
+			return nil, "", indentErr
+		}
+		return append(indented.Bytes(), '\n'), internal.TemplateJSONExtension, nil
+	}
+
 	yml, ymlErr := yaml.Marshal(template)
 	if ymlErr != nil {
-		return "", ymlErr
+		return nil, "", ymlErr
 	}
-	writeErr := ioutil.WriteFile(fileName, []byte(yml), 0644)
+	return []byte(yml), internal.TemplateYmlExtension, nil
+}
+
+// saveStackAsYml exports the stack template as yml, or as json per Cmd.Export.Format, and returns the file name.
+// with --stdout the template is printed instead and no file name is returned
+func saveStackAsYml(exportConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) (string, error) {
+	body, extension, renderErr := renderStackTemplate(exportConfig, stackValue)
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	if flags.ExportStdout {
+		if exportConfig.Cmd.Export.Format != "json" {
+			os.Stdout.WriteString("---\n")
+		}
+		_, writeErr := os.Stdout.Write(body)
+		return "", writeErr
+	}
+
+	exportPath := internal.GetStackArtifacts(exportConfig, stack, buildInstance).ExportPath
+	os.MkdirAll(filepath.Dir(exportPath), 0755)
+
+	fileName := exportPath + extension
+	log.Infof("%s %s %s %s\n", au.White("Exported"), au.Magenta(stack.Name), au.White("⤏"), fileName)
+	writeErr := ioutil.WriteFile(fileName, body, 0644)
 	if writeErr != nil {
 		return "", writeErr
 	}
+
 	return fileName, nil
 }
 
+// saveStackParameters writes the stack's parameters next to its exported template in the format of Cmd.Export.Parameters
+func saveStackParameters(exportConfig *internal.Config, stack internal.Stack, buildInstance *build.Instance, stackValue cue.Value) (string, error) {
+	parameters, parametersErr := getParameters(stack, buildInstance, stackValue)
+	if parametersErr != nil {
+		return "", parametersErr
+	}
+	sort.Slice(parameters, func(i, j int) bool {
+		return aws.ToString(parameters[i].ParameterKey) < aws.ToString(parameters[j].ParameterKey)
+	})
+
+	var fileName string
+	var content interface{}
+
+	exportPath := internal.GetStackArtifacts(exportConfig, stack, buildInstance).ExportPath
+	switch exportConfig.Cmd.Export.Parameters {
+	case "cli":
+		type cliParameter struct {
+			ParameterKey   string
+			ParameterValue string
+		}
+		cliParameters := []cliParameter{}
+		for _, parameter := range parameters {
+			cliParameters = append(cliParameters, cliParameter{ParameterKey: aws.ToString(parameter.ParameterKey), ParameterValue: aws.ToString(parameter.ParameterValue)})
+		}
+		fileName = exportPath + internal.CliParametersExtension
+		content = cliParameters
+
+	case "template-configuration":
+		templateConfiguration := struct {
+			Parameters map[string]string
+			Tags       map[string]string `json:",omitempty"`
+		}{Parameters: make(map[string]string), Tags: make(map[string]string)}
+		for _, parameter := range parameters {
+			templateConfiguration.Parameters[aws.ToString(parameter.ParameterKey)] = aws.ToString(parameter.ParameterValue)
+		}
+		for _, tag := range getTags(stack, buildInstance) {
+			templateConfiguration.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		fileName = exportPath + internal.TemplateConfigExtension
+		content = templateConfiguration
+
+	default:
+		return "", fmt.Errorf("unknown parameters format %s", exportConfig.Cmd.Export.Parameters)
+	}
+
+	contentBytes, marshalErr := json.MarshalIndent(content, "", "  ")
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+
+	log.Infof("%s %s %s %s\n", au.White("Exported"), au.Magenta(stack.Name), au.White("⤏"), fileName)
+	return fileName, ioutil.WriteFile(fileName, append(contentBytes, '\n'), 0600)
+}
+
 func init() {
 	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().BoolVar(&flags.ExportStdout, "stdout", false, "Print templates to stdout instead of writing files.")
+	exportCmd.Flags().StringVar(&flags.ExportFormat, "format", "", "Export templates as yml or json. Overrides Cmd.Export.Format.")
+	exportCmd.Flags().BoolVar(&flags.ExportPrune, "prune", false, "Delete previously exported files that are no longer generated by any stack.")
+	exportCmd.Flags().BoolVar(&flags.ExportCheck, "check", false, "Write nothing, but fail if exported templates are missing, out of date, or stale.")
+	exportCmd.Flags().StringVar(&flags.ExportParameters, "parameters", "", "Also export parameters as cli or template-configuration. Overrides Cmd.Export.Parameters.")
 }
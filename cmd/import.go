@@ -1,8 +1,16 @@
 package cmd
 
 import (
-	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
 	"cuelang.org/go/cue/format"
 	"cuelang.org/go/encoding/json"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,14 +19,19 @@ import (
 	"github.com/cue-sh/stax/internal"
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
+	goYaml "gopkg.in/yaml.v2"
 )
 
+// corePackage is the import path of the Cue schemas in cue/core
+const corePackage = "github.com/cue-sh/stax/cue/core"
+
 func init() {
 	rootCmd.AddCommand(importCmd)
-	importCmd.Flags().StringVar(&flags.ImportStack, "stack", "", "Stack name to import. (Required)")
-	importCmd.MarkFlagRequired("stack")
-	importCmd.Flags().StringVar(&flags.ImportRegion, "region", "", "Region where stack is located. (Required)")
-	importCmd.MarkFlagRequired("region")
+	importCmd.Flags().StringVar(&flags.ImportStack, "stack", "", "Stack name to import. (Required unless --resources)")
+	importCmd.Flags().StringVar(&flags.ImportRegion, "region", "", "Region where stack is located. (Required unless --resources)")
+	importCmd.Flags().BoolVar(&flags.ImportResources, "resources", false, "Import existing resources declared in ResourcesToImport of the evaluated stacks via an IMPORT change set.")
+	importCmd.Flags().BoolVar(&flags.ImportAll, "all", false, "Import every stack in --profile and --region. Use --stacks to filter by name.")
+	importCmd.Flags().StringVar(&flags.ImportStatus, "status", "", "Comma-separated stack statuses to import with --all. Defaults to every status except DELETE_COMPLETE.")
 }
 
 // importCmd represents the import command
@@ -28,60 +41,371 @@ var importCmd = &cobra.Command{
 	Long: `import operates on a single stack provided by --stack.
 	
 import will download the template as stored in CloudFormation, wrap it in the
-Stacks pattern, and save it as a formatted Cue file.
+Stacks pattern as a core.#Stack, and save it as a formatted Cue file.
+
+Imported stacks are made maintainable in Cue: the Profile, Region and
+Environment (from --environment, an Environment tag, or the stack name) are
+populated, Region is core.#RegionCodes[RegionCode] for the codes of
+core.#RegionCodes and is otherwise derived by stax from RegionCode, hardcoded
+regions and account ids, as whole values or in ARNs, become the AWS::Region
+and AWS::AccountId pseudo parameters, Fn::Join is converted to Fn::Sub, and
+a lone pseudo parameter is always a Ref. Parameters, including their original
+defaults, are kept as is. When the Environment cannot be determined, import
+prompts for it, and --all fails the stack.
+
+With --all, import operates on every stack found in --profile and --region,
+optionally filtered by --stacks and --status. Nested stacks are skipped since
+they are managed by their parent. Each stack is written to its own file under
+the directory provided as the path argument (default "."):
+
+<path>/<profile>/<region>/<stack name>/template.cfn.cue
+
+Along with the template, the stack's tags and termination protection are
+written to Cue. The current parameter values are written to an overrides.yml
+file next to the template and referenced from the stack's Overrides. NoEcho
+parameter values cannot be read back from CloudFormation, they are left out
+as commented placeholders and deploy fails until they are filled in by hand.
+
+With --resources, import instead operates on every stack found among the
+evaluated cue files that declares ResourcesToImport. Existing resources (a
+bucket, table, role...) are adopted into a new or existing stack by creating
+a change set of type IMPORT:
+
+Stacks: "my-stack": {
+	ResourcesToImport: Bucket: Identifier: BucketName: "my-existing-bucket"
+	Template: Resources: Bucket: {
+		Type:           "AWS::S3::Bucket"
+		DeletionPolicy: "Retain"
+		Properties: BucketName: "my-existing-bucket"
+	}
+}
+
+As CloudFormation requires, every resource to import must be declared in the
+template with DeletionPolicy: "Retain". The template must otherwise match the
+deployed stack, as an IMPORT change set cannot carry other changes.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		defer log.Flush()
 
+		if flags.ImportResources {
+			importResources(args)
+			return
+		}
+
+		if flags.ImportAll {
+			importAll(args)
+			return
+		}
+
+		if flags.ImportStack == "" || flags.ImportRegion == "" {
+			log.Fatal("--stack and --region are required for import")
+			return
+		}
+
 		if flags.Profile == "" {
 			log.Error("--profile is required for import")
 		}
 
-		flags.StackNameRegexPattern = "^" + flags.ImportStack + "$"
-
 		// get a session and cloudformation service client
 		cfn := internal.GetCloudFormationClient(flags.Profile, flags.ImportRegion)
 
-		log.Infof("%s %s...", au.White("Importing"), au.Magenta(flags.ImportStack))
+		describeStacksInput := cloudformation.DescribeStacksInput{StackName: aws.String(flags.ImportStack)}
+		describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &describeStacksInput)
+		if describeStacksErr != nil {
+			log.Error(describeStacksErr)
+			return
+		}
 
-		getTemplateOutput, getTemplateErr := cfn.GetTemplate(context.TODO(), &cloudformation.GetTemplateInput{StackName: aws.String(flags.ImportStack), TemplateStage: types.TemplateStageProcessed})
+		pathToTemplate := "./template.cfn.cue"
+		if len(args) > 0 {
+			pathToTemplate = args[0]
+		}
 
-		if getTemplateErr != nil {
-			log.Error(getTemplateErr)
+		importErr := importDescribedStack(cfn, describeStacksOutput.Stacks[0], pathToTemplate)
+		if importErr != nil {
+			log.X()
+			log.Error(importErr)
 			return
 		}
+		log.Check()
+	},
+}
 
-		templateBytes := []byte(aws.ToString(getTemplateOutput.TemplateBody))
+// getTemplateAsCue downloads the processed template of the stack and returns it as idiomatic, formatted Cue
+func getTemplateAsCue(cfn *cloudformation.Client, stackName, region, accountID string) (string, error) {
+	getTemplateOutput, getTemplateErr := cfn.GetTemplate(ctx, &cloudformation.GetTemplateInput{StackName: aws.String(stackName), TemplateStage: types.TemplateStageProcessed})
+	if getTemplateErr != nil {
+		return "", getTemplateErr
+	}
 
-		if !json.Valid(templateBytes) {
-			// it must be yaml so convert to json
-			var yamlErr error
-			templateBytes, yamlErr = yaml.YAMLToJSON(templateBytes)
-			if yamlErr != nil {
-				log.Error(yamlErr)
-				return
-			}
+	templateBytes := []byte(aws.ToString(getTemplateOutput.TemplateBody))
+
+	if !json.Valid(templateBytes) {
+		// it must be yaml so convert to json
+		var yamlErr error
+		templateBytes, yamlErr = yaml.YAMLToJSON(templateBytes)
+		if yamlErr != nil {
+			return "", yamlErr
 		}
+	}
+
+	expr, extractErr := json.Extract("", templateBytes)
+	if extractErr != nil {
+		return "", extractErr
+	}
 
-		expr, extractErr := json.Extract("", templateBytes)
-		if extractErr != nil {
-			log.Error(extractErr)
+	result, formatErr := format.Node(internal.IdiomaticTemplate(expr, region, accountID), format.Simplify())
+	if formatErr != nil {
+		return "", formatErr
+	}
+
+	return string(result), nil
+}
+
+// importAll writes every stack in the profile and region as its own template.cfn.cue
+func importAll(args []string) {
+	if flags.Profile == "" || flags.ImportRegion == "" {
+		log.Fatal("--profile and --region are required for import --all")
+		return
+	}
+
+	var stackNameRegexp *regexp.Regexp
+	if flags.StackNameRegexPattern != "" {
+		var stackNameRegexpErr error
+		stackNameRegexp, stackNameRegexpErr = regexp.Compile(flags.StackNameRegexPattern)
+		if stackNameRegexpErr != nil {
+			log.Fatal(stackNameRegexpErr)
 			return
 		}
+	}
+
+	statuses := make(map[types.StackStatus]bool)
+	if flags.ImportStatus != "" {
+		for _, status := range strings.Split(flags.ImportStatus, ",") {
+			statuses[types.StackStatus(strings.TrimSpace(status))] = true
+		}
+	}
+
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+
+	// get a session and cloudformation service client
+	cfn := internal.GetCloudFormationClient(flags.Profile, flags.ImportRegion)
 
-		result, formatErr := format.Node(expr, format.Simplify())
-		if formatErr != nil {
-			log.Error(formatErr)
+	log.Debugf("Describing stacks in %s:%s\n", flags.Profile, flags.ImportRegion)
+	paginator := cloudformation.NewDescribeStacksPaginator(cfn, &cloudformation.DescribeStacksInput{})
+	for paginator.HasMorePages() {
+		describeStacksOutput, describeStacksErr := paginator.NextPage(ctx)
+		if describeStacksErr != nil {
+			log.Fatal(describeStacksErr)
 			return
 		}
 
-		templateErr := createTemplate(args, string(result))
-		if templateErr != nil {
-			log.Error(templateErr)
+		for _, describedStack := range describeStacksOutput.Stacks {
+			stackName := aws.ToString(describedStack.StackName)
+
+			if describedStack.ParentId != nil {
+				log.Debug("Skipping nested stack", stackName)
+				continue
+			}
+			if stackNameRegexp != nil && !stackNameRegexp.MatchString(stackName) {
+				continue
+			}
+			if len(statuses) > 0 && !statuses[describedStack.StackStatus] {
+				continue
+			}
+			if len(statuses) < 1 && describedStack.StackStatus == types.StackStatusDeleteComplete {
+				continue
+			}
+
+			importErr := importDescribedStack(cfn, describedStack, filepath.Join(root, flags.Profile, flags.ImportRegion, stackName, "template.cfn.cue"))
+			if importErr != nil {
+				log.X()
+				log.Error(importErr)
+				continue
+			}
+			log.Check()
 		}
-		log.Check()
-	},
+	}
+}
+
+// importDescribedStack writes the stack as a core.#Stack to pathToTemplate, along with its current parameter values
+// written to an overrides.yml in the same directory
+func importDescribedStack(cfn *cloudformation.Client, describedStack types.Stack, pathToTemplate string) error {
+	stackName := aws.ToString(describedStack.StackName)
+	dir := filepath.Dir(pathToTemplate)
+	log.Infof("%s %s %s %s...", au.White("Importing"), au.Magenta(stackName), au.White("⤏"), pathToTemplate)
+
+	// Environment is required, prompt for it when importing a single stack
+	environment := getImportedEnvironment(describedStack)
+	if environment == "" && !flags.ImportAll {
+		environment = promptEnvironment(stackName)
+	}
+	if environment == "" {
+		return fmt.Errorf("Environment of %s could not be determined, set it with --environment or an Environment tag", stackName)
+	}
+
+	// the stack arn holds the account id: arn:aws:cloudformation:<region>:<account>:stack/<name>/<id>
+	var accountID string
+	if arn := strings.Split(aws.ToString(describedStack.StackId), ":"); len(arn) > 4 {
+		accountID = arn[4]
+	}
+
+	template, templateErr := getTemplateAsCue(cfn, stackName, flags.ImportRegion, accountID)
+	if templateErr != nil {
+		return templateErr
+	}
+
+	mkdirErr := os.MkdirAll(dir, 0755)
+	if mkdirErr != nil {
+		return mkdirErr
+	}
+
+	fields := []string{
+		"Name: " + strconv.Quote(stackName),
+		"Profile: " + strconv.Quote(flags.Profile),
+	}
+
+	fields = append(fields, "Environment: "+strconv.Quote(environment))
+
+	regionCode := flags.RegionCode
+	if regionCode == "" {
+		regionCode = config.GetRegionCode(flags.ImportRegion)
+	}
+	// stax derives Region from RegionCode, codes of core.#RegionCodes are referenced so the region is explicit in Cue
+	if regionCode != "" {
+		fields = append(fields, "RegionCode: "+strconv.Quote(regionCode))
+		if coreRegionCodes, _ := internal.GetRegionCodes(); coreRegionCodes[regionCode] == flags.ImportRegion {
+			fields = append(fields, "Region: core.#RegionCodes[RegionCode]")
+		}
+	} else {
+		fields = append(fields, "Region: "+strconv.Quote(flags.ImportRegion))
+	}
+
+	if aws.ToBool(describedStack.EnableTerminationProtection) {
+		fields = append(fields, "EnableTerminationProtection: true")
+	}
+	if describedStack.RoleARN != nil {
+		fields = append(fields, "Role: "+strconv.Quote(aws.ToString(describedStack.RoleARN)))
+	}
+	if len(describedStack.Tags) > 0 {
+		tags := "Tags: {\n"
+		for _, tag := range describedStack.Tags {
+			tags += strconv.Quote(aws.ToString(tag.Key)) + ": " + strconv.Quote(aws.ToString(tag.Value)) + "\n"
+		}
+		fields = append(fields, tags+"}")
+	}
+
+	if len(describedStack.Parameters) > 0 {
+		parameters := make(map[string]string)
+		var noEchoKeys []string
+		for _, parameter := range describedStack.Parameters {
+			parameterKey := aws.ToString(parameter.ParameterKey)
+			parameterValue := aws.ToString(parameter.ParameterValue)
+			// CloudFormation masks the values of NoEcho parameters, deploy fails until they are set
+			if parameterValue == internal.NoEchoMask {
+				log.Warnf("\n  NoEcho parameter %s must be set in overrides.yml", parameterKey)
+				noEchoKeys = append(noEchoKeys, parameterKey)
+				continue
+			}
+			parameters[parameterKey] = parameterValue
+		}
+
+		var overridesBytes []byte
+		if len(parameters) > 0 {
+			var overridesErr error
+			overridesBytes, overridesErr = goYaml.Marshal(parameters)
+			if overridesErr != nil {
+				return overridesErr
+			}
+		}
+		for _, noEchoKey := range noEchoKeys {
+			overridesBytes = append(overridesBytes, []byte("# "+noEchoKey+": NoEcho parameter, set its value before deploying\n")...)
+		}
+		writeErr := ioutil.WriteFile(filepath.Join(dir, "overrides.yml"), overridesBytes, 0644)
+		if writeErr != nil {
+			return writeErr
+		}
+		fields = append(fields, `Overrides: "${STX::CuePath}/overrides.yml": {}`)
+	}
+
+	fields = append(fields, "Template: "+template)
+
+	output := "package " + config.PackageName + "\n\n" +
+		"import \"" + corePackage + "\"\n\n" +
+		"Stacks: " + strconv.Quote(stackName) + ": core.#Stack & {\n" + strings.Join(fields, "\n") + "\n}\n"
+
+	cueOutput, cueOutputErr := format.Source([]byte(output), format.Simplify())
+	if cueOutputErr != nil {
+		log.Debug(output)
+		return cueOutputErr
+	}
+
+	return ioutil.WriteFile(pathToTemplate, cueOutput, 0644)
+}
+
+// getImportedEnvironment returns --environment, or else the first of an Environment tag or a stack name segment
+// that is one of the configured Environments
+func getImportedEnvironment(describedStack types.Stack) string {
+	if flags.Environment != "" {
+		return flags.Environment
+	}
+
+	for _, tag := range describedStack.Tags {
+		if strings.EqualFold(aws.ToString(tag.Key), "environment") && config.IsEnvironment(aws.ToString(tag.Value)) {
+			return aws.ToString(tag.Value)
+		}
+	}
+
+	for _, segment := range strings.Split(aws.ToString(describedStack.StackName), "-") {
+		if config.IsEnvironment(segment) {
+			return segment
+		}
+	}
+
+	return ""
+}
+
+// promptEnvironment asks for the environment of the stack, returns "" unless it is one of the configured Environments
+func promptEnvironment(stackName string) string {
+	log.Infof("\n%s\n%s", au.Index(255-88, "Environment of "+stackName+" could not be determined, enter one of: "+strings.Join(config.Environments, ", ")), au.Gray(11, "▶︎"))
+	environment, _ := readLine(ctx)
+	if !config.IsEnvironment(environment) {
+		return ""
+	}
+	return environment
+}
+
+// importResources deploys an IMPORT change set for each evaluated stack that declares ResourcesToImport
+func importResources(args []string) {
+	buildInstances := internal.GetBuildInstances(args, config.PackageName)
+
+	internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+		stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
+		if stacksIteratorErr != nil {
+			log.Fatal(stacksIteratorErr)
+		}
+
+		for stacksIterator.Next() {
+			stackValue := stacksIterator.Value()
+			var stack internal.Stack
+			decodeErr := stackValue.Decode(&stack)
+			if decodeErr != nil {
+				log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
+				continue
+			}
+
+			if len(stack.ResourcesToImport) < 1 {
+				log.Debug("No ResourcesToImport defined for", stack.Name)
+				continue
+			}
+
+			deployStack(dirConfig, stack, buildInstance, stackValue)
+		}
+	})
 }
 
 // all-eks-deployer-kubectl-layer-usw2
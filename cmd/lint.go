@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	"github.com/cue-sh/stax/internal"
+	"github.com/cue-sh/stax/logger"
+	"github.com/spf13/cobra"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Checks stack templates for common mistakes without calling AWS",
+	Long: `Lint will operate on every stack found in the evaluated cue files.
+Each Template is checked offline for unresolved Ref, Fn::GetAtt and Fn::Sub targets,
+unused parameters, DependsOn and outputs referring to missing resources,
+invalid logical ids, and CloudFormation template size and resource count limits.
+Stacks are also checked against the Cue policies found in the Policies.Path
+of their directory config.
+
+Errors are reported with their Cue source position and make stax exit non-zero.
+Warnings are reported but do not fail the command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		defer log.Flush()
+
+		buildInstances := internal.GetBuildInstances(args, config.PackageName)
+
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
+			if stacksIteratorErr != nil {
+				log.Fatal(stacksIteratorErr)
+				return
+			}
+
+			for stacksIterator.Next() {
+				stackValue := stacksIterator.Value()
+				var stack internal.Stack
+				decodeErr := stackValue.Decode(&stack)
+				if decodeErr != nil {
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
+					continue
+				}
+
+				log.Infof("%s %s %s %s:%s\n", au.White("Linting"), au.Magenta(stack.Name), au.White("⤏"), au.Green(stack.Profile), au.Cyan(stack.Region))
+
+				findings := internal.LintTemplate(stackValue.LookupPath(cue.ParsePath("Template")))
+				for _, violation := range internal.CheckPolicies(getPolicies(dirConfig), stackValue) {
+					findings = append(findings, violation.Findings()...)
+				}
+				sort.SliceStable(findings, func(i, j int) bool {
+					a, b := findings[i].Pos.Position(), findings[j].Pos.Position()
+					if a.Filename != b.Filename {
+						return a.Filename < b.Filename
+					}
+					if a.Line != b.Line {
+						return a.Line < b.Line
+					}
+					return a.Column < b.Column
+				})
+
+				printFindings(findings)
+			}
+		})
+	},
+}
+
+// policies caches the loaded policies by their resolved Policies.Path
+var policies = make(map[string][]internal.Policy)
+
+// getPolicies loads the policies from the Policies.Path of dirConfig the first time that path is used
+func getPolicies(dirConfig *internal.Config) []internal.Policy {
+	policiesPath := internal.PoliciesPath(dirConfig)
+	loaded, ok := policies[policiesPath]
+	if !ok {
+		var policiesErr error
+		loaded, policiesErr = internal.LoadPolicies(dirConfig)
+		if policiesErr != nil {
+			log.Fatal(strings.Join(internal.ErrorMessages(policiesErr), "\n"))
+		}
+		log.Debug("Loaded", len(loaded), "policies from", policiesPath)
+		policies[policiesPath] = loaded
+	}
+	return loaded
+}
+
+// checkPolicies prints the policies of dirConfig violated by the stack and returns false if any of them has the error
+// severity
+func checkPolicies(dirConfig *internal.Config, stackValue cue.Value) bool {
+	passed := true
+	var findings []internal.LintFinding
+	for _, violation := range internal.CheckPolicies(getPolicies(dirConfig), stackValue) {
+		if violation.Policy.Severity == internal.PolicyError {
+			passed = false
+		}
+		findings = append(findings, violation.Findings()...)
+	}
+	printFindings(findings)
+	return passed
+}
+
+func printFindings(findings []internal.LintFinding) {
+	for _, finding := range findings {
+		position := internal.RelativePosition(finding.Pos)
+		if finding.Severity == internal.LintError {
+			log.Errorf("  %s %s\n", position, finding.Message)
+			log.SetExitCode(logger.ExitValidation)
+		} else {
+			log.Warnf("  %s %s\n", position, finding.Message)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
@@ -31,9 +31,9 @@ Each stack will be converted to YAML then printed to stdout.`,
 		log.Debug("Getting build instances...")
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 		log.Debug("Processing build instances...")
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
 
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -52,7 +52,7 @@ Each stack will be converted to YAML then printed to stdout.`,
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
 					if !flags.PrintHideErrors {
-						log.Error(decodeErr)
+						log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					}
 					continue
 				}
@@ -85,7 +85,7 @@ Each stack will be converted to YAML then printed to stdout.`,
 
 				if ymlErr != nil {
 					if !flags.PrintHideErrors {
-						log.Error(ymlErr)
+						log.Error(internal.StackError(ymlErr, buildInstance, stackValue))
 					}
 				} else {
 					if !flags.PrintOnlyErrors {
@@ -93,6 +93,16 @@ Each stack will be converted to YAML then printed to stdout.`,
 						log.Infof("  %s\n", ymlStr)
 					}
 				}
+
+				if flags.PrintDefaults {
+					for _, defaultedField := range internal.DefaultedFields(stacksIterator.Defaults()) {
+						log.Infof("  %s %s %s %s\n", au.Cyan(defaultedField.Path), au.White("⇐"), au.Green("StackDefaults."+defaultedField.Source), au.Gray(11, internal.RelativePosition(defaultedField.Pos)))
+					}
+				}
+
+				if !flags.PrintHideErrors {
+					checkPolicies(dirConfig, stackValue)
+				}
 			}
 		})
 	},
@@ -106,6 +116,7 @@ func init() {
 	printCmd.Flags().BoolVar(&flags.PrintOnlyErrors, "only-errors", false, "Only print errors. Cannot be used in concjunction with --hide-errors")
 	printCmd.Flags().BoolVar(&flags.PrintHideErrors, "hide-errors", false, "Hide errors. Cannot be used in concjunction with --only-errors")
 	printCmd.Flags().BoolVar(&flags.PrintHidePath, "hide-path", false, "Hide instance path.")
+	printCmd.Flags().BoolVar(&flags.PrintDefaults, "defaults", false, "Show which StackDefaults of config.stax.cue supplied each field.")
 	printCmd.Flags().StringVarP(&flags.PrintPath, "path", "p", "", "Dot-notation style path to key to print. Eg: Template.Resources.Alb or Template.Outputs")
 
 }
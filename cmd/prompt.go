@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var stdinLines chan string
+var stdinOnce sync.Once
+
+// readLine returns the next line typed by the user, or false when ctx is done or stdin is closed first.
+// A single reader owns stdin so that a prompt abandoned on interrupt does not swallow the answer to the next one
+func readLine(ctx context.Context) (string, bool) {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				stdinLines <- scanner.Text()
+			}
+			close(stdinLines)
+		}()
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", false
+	case line, ok := <-stdinLines:
+		return strings.TrimSpace(line), ok
+	}
+}
+
+// confirm returns true when the user answers y or yes
+func confirm(ctx context.Context) bool {
+	input, ok := readLine(ctx)
+	if !ok {
+		return false
+	}
+	matched, _ := regexp.MatchString("^(y){1}(es)?$", strings.ToLower(input))
+	return matched
+}
@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"context"
-	"os"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -10,7 +8,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/cue-sh/stax/internal"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
@@ -34,8 +31,8 @@ resources currently managed in the stack.
 
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -45,7 +42,7 @@ resources currently managed in the stack.
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
 
@@ -55,7 +52,7 @@ resources currently managed in the stack.
 				log.Infof("%s %s...\n", au.White("Describing"), au.Magenta(stack.Name))
 
 				describeStackResourcesInput := cloudformation.DescribeStackResourcesInput{StackName: aws.String(stack.Name)}
-				describeStackResourcesOutput, describeStackResourcesErr := cfn.DescribeStackResources(context.TODO(), &describeStackResourcesInput)
+				describeStackResourcesOutput, describeStackResourcesErr := cfn.DescribeStackResources(ctx, &describeStackResourcesInput)
 				if describeStackResourcesErr != nil {
 					log.Error(describeStackResourcesErr)
 					continue
@@ -63,10 +60,7 @@ resources currently managed in the stack.
 				// TODO add --aws-output(?) to be used in conjunction with --debug
 				// log.Debugf("%+v\n", describeStackResourcesOutput)
 
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoWrapText(false)
-				table.SetHeader([]string{"Logical ID", "Physical ID", "Type", "Status"})
-				table.SetHeaderColor(tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor})
+				table := log.NewTable("Logical ID", "Physical ID", "Type", "Status")
 
 				for _, resource := range describeStackResourcesOutput.StackResources {
 
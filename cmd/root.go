@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -15,12 +16,16 @@ var au aurora.Aurora        // console output color
 var config *internal.Config // holds settings in config.stax.cue files
 var flags internal.Flags    // holds command line flags
 var log *logger.Logger      // commong log
+var ctx context.Context     // cancelled on the first interrupt
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "stax",
 	Short: "Export and deploy CUE-based CloudFormation stacks.",
 	Long:  `Yada yada yada.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		log.SetCommand(cmd.Name())
+	},
 	// Run: func(cmd *cobra.Command, args []string) {},
 }
 
@@ -28,9 +33,19 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 
+	// log.Fatal unwinds the command, exit with the recorded code if the command did not defer log.Flush
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(logger.Abort); !ok {
+				panic(r)
+			}
+			log.Flush()
+		}
+	}()
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(logger.ExitError)
 	}
 
 }
@@ -39,10 +54,20 @@ func init() {
 	cobra.OnInitialize(func() {
 		au = aurora.NewAurora(!flags.NoColor)
 		log = logger.NewLogger(flags.Debug, flags.NoColor)
+		log.SetClassifier(internal.ExitCode)
+		ctx = internal.NewInterruptContext(log)
+		if formatErr := log.SetFormat(flags.LogFormat); formatErr != nil {
+			log.Fatal(formatErr)
+		}
+		if flags.LogFile != "" {
+			if openErr := log.OpenFile(flags.LogFile); openErr != nil {
+				log.Fatal(openErr)
+			}
+		}
 
 		if config == nil {
 			log.Debug("Loading config...")
-			config = internal.LoadConfig(log)
+			config = internal.LoadConfig(flags, log)
 		}
 		log.Debugf("Loaded flags %+v\n", flags)
 		log.Debug("Root command initialized.")
@@ -58,4 +83,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&flags.Has, "has", "", "Includes only stacks that contain the provided path. E.g.: Template.Parameters")
 	rootCmd.PersistentFlags().BoolVar(&flags.Debug, "debug", false, "Enables verbose output of debug level messages.")
 	rootCmd.PersistentFlags().BoolVar(&flags.NoColor, "no-color", false, "Disables color output.")
+	rootCmd.PersistentFlags().StringVar(&flags.LogFormat, "log-format", os.Getenv("STAX_LOG_FORMAT"), "Console log format, text or json lines. Defaults to $STAX_LOG_FORMAT or text.")
+	rootCmd.PersistentFlags().StringVar(&flags.LogFile, "log-file", os.Getenv("STAX_LOG_FILE"), "Appends a full transcript, including debug messages, to this file. Defaults to $STAX_LOG_FILE.")
+	rootCmd.PersistentFlags().StringVar(&flags.Config, "config", "", "Path to a config.stax.cue taking precedence over the discovered ones.")
 }
@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"context"
-	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/build"
 	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/literal"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
 	"github.com/cue-sh/stax/internal"
 	"github.com/spf13/cobra"
 )
@@ -22,8 +24,34 @@ var saveCmd = &cobra.Command{
 	Long: `save operates on every stack found in the evaluated cue files.
 	
 For each stack that has Outputs defined, save will query CloudFormation
-and write the Outputs as cue-formatted key:value pairs. Each stack will be
-saved as its own file with a .out.cue extension.
+and write the stack's Name, Profile, Region and Arn along with its Outputs,
+each with its Value, ExportName and Description. Each stack will be saved as
+its own file with a .out.cue extension, for example:
+
+"my-stack": {
+	Name:    "my-stack"
+	Profile: "dev"
+	Region:  "us-west-2"
+	Arn:     "arn:aws:cloudformation:..."
+	Outputs: close({
+		VpcId: #StackOutput & {
+			Value:      "vpc-0123"
+			ExportName: "my-stack-VpcId"
+		}
+	})
+	VpcId: Outputs["VpcId"].Value
+}
+
+Outputs are closed, referencing an output the stack does not have is a Cue
+error. Outputs used to be saved as plain values of the stack, each output also
+keeps that top level alias to its Value, unless it is named Name, Profile,
+Region, Arn or Outputs.
+
+The package of the files, which must be a Cue identifier, and the output keys
+whose values are comma delimited lists are set in config.stax.cue via:
+
+Cmd: Save: PackageName: "outputs"
+Cmd: Save: CommaDelimited: ["SubnetIds"]
 
 The outputs themselves do not need to be defined in Cue. For example if you
 want to reference outputs in stacks that were deployed with some other tool,
@@ -52,8 +80,8 @@ or any string that begins with "_".
 
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -63,11 +91,11 @@ or any string that begins with "_".
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
 
-				saveErr := saveStackOutputs(config, buildInstance, stack)
+				saveErr := saveStackOutputs(dirConfig, buildInstance, stack)
 				if saveErr != nil {
 					log.Error(saveErr)
 				}
@@ -76,13 +104,13 @@ or any string that begins with "_".
 	},
 }
 
-func saveStackOutputs(config *internal.Config, buildInstance *build.Instance, stack internal.Stack) error {
+func saveStackOutputs(dirConfig *internal.Config, buildInstance *build.Instance, stack internal.Stack) error {
 
 	// get a session and cloudformation service client
 	cfn := internal.GetCloudFormationClient(stack.Profile, stack.Region)
 
 	describeStacksInput := cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)}
-	describeStacksOutput, describeStacksErr := cfn.DescribeStacks(context.TODO(), &describeStacksInput)
+	describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &describeStacksInput)
 	if describeStacksErr != nil {
 		return describeStacksErr
 	}
@@ -92,16 +120,10 @@ func saveStackOutputs(config *internal.Config, buildInstance *build.Instance, st
 		return nil
 	}
 
-	fileName := buildInstance.Dir + "/" + config.Cmd.Save.OutFilePrefix + stack.Name + ".out.cue"
+	fileName := internal.GetStackArtifacts(dirConfig, stack, buildInstance).Outputs
 	log.Infof("%s %s %s %s\n", au.White("Saving"), au.Magenta(stack.Name), au.White("⤏"), fileName)
 
-	// create the .out.cue file
-	result := "package outputs" + "\n\n\"" + stack.Name + "\": {\n"
-	// convert cloudformation outputs into simple key:value pairs
-	for _, output := range describeStacksOutput.Stacks[0].Outputs {
-		result += fmt.Sprintf("\"%s\":\"%s\"\n", aws.ToString(output.OutputKey), aws.ToString(output.OutputValue))
-	}
-	result += "}\n"
+	result := renderStackOutputs(dirConfig, stack, describeStacksOutput.Stacks[0])
 
 	// use cue to format the output
 	cueOutput, cueOutputErr := format.Source([]byte(result), format.Simplify())
@@ -111,9 +133,7 @@ func saveStackOutputs(config *internal.Config, buildInstance *build.Instance, st
 	}
 
 	// save it!
-	if len(config.Cmd.Save.OutFilePrefix) > 0 && config.Cmd.Save.OutFilePrefix[len(config.Cmd.Save.OutFilePrefix)-1:] == config.OsSeparator {
-		os.MkdirAll(buildInstance.Dir+"/"+config.Cmd.Save.OutFilePrefix, 0766)
-	}
+	os.MkdirAll(filepath.Dir(fileName), 0766)
 
 	writeErr := ioutil.WriteFile(fileName, []byte(cueOutput), 0644)
 	if writeErr != nil {
@@ -123,6 +143,61 @@ func saveStackOutputs(config *internal.Config, buildInstance *build.Instance, st
 	return nil
 }
 
+// renderStackOutputs returns the .out.cue file of the stack, which closes Outputs so that referencing an output the
+// stack does not have is an error
+func renderStackOutputs(dirConfig *internal.Config, stack internal.Stack, deployedStack types.Stack) string {
+	commaDelimited := make(map[string]bool)
+	for _, outputKey := range dirConfig.Cmd.Save.CommaDelimited {
+		commaDelimited[outputKey] = true
+	}
+
+	result := "package " + dirConfig.Cmd.Save.PackageName + "\n\n"
+	result += "#StackOutput: {\nValue: string | [...string]\nExportName?: string\nDescription?: string\n}\n\n"
+	result += literal.String.Quote(stack.Name) + ": {\n"
+	result += "Name: " + literal.String.Quote(stack.Name) + "\n"
+	result += "Profile: " + literal.String.Quote(stack.Profile) + "\n"
+	result += "Region: " + literal.String.Quote(stack.Region) + "\n"
+	result += "Arn: " + literal.String.Quote(aws.ToString(deployedStack.StackId)) + "\n"
+	result += "Outputs: close({\n"
+	for _, output := range deployedStack.Outputs {
+		outputKey := aws.ToString(output.OutputKey)
+		outputValue := aws.ToString(output.OutputValue)
+
+		value := literal.String.Quote(outputValue)
+		if commaDelimited[outputKey] {
+			var items []string
+			for _, item := range strings.Split(outputValue, ",") {
+				items = append(items, literal.String.Quote(strings.TrimSpace(item)))
+			}
+			value = "[" + strings.Join(items, ", ") + "]"
+		}
+
+		result += literal.String.Quote(outputKey) + ": #StackOutput & {\nValue: " + value + "\n"
+		if output.ExportName != nil {
+			result += "ExportName: " + literal.String.Quote(aws.ToString(output.ExportName)) + "\n"
+		}
+		if output.Description != nil {
+			result += "Description: " + literal.String.Quote(aws.ToString(output.Description)) + "\n"
+		}
+		result += "}\n"
+	}
+	result += "})\n"
+
+	// outputs were saved as plain values of the stack before they had a schema, keep them referenceable that way
+	for _, output := range deployedStack.Outputs {
+		outputKey := aws.ToString(output.OutputKey)
+		if stackOutputFields[outputKey] {
+			continue
+		}
+		result += literal.String.Quote(outputKey) + ": Outputs[" + literal.String.Quote(outputKey) + "].Value\n"
+	}
+	result += "}\n"
+	return result
+}
+
+// stackOutputFields are the fields of a saved stack, an output named after one of them has no top level alias
+var stackOutputFields = map[string]bool{"Name": true, "Profile": true, "Region": true, "Arn": true, "Outputs": true}
+
 func init() {
 	rootCmd.AddCommand(saveCmd)
 }
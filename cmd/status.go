@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"context"
-	"os"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -10,7 +8,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/cue-sh/stax/internal"
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
@@ -29,9 +26,9 @@ If the stack does not exist status will return an error.
 
 		buildInstances := internal.GetBuildInstances(args, config.PackageName)
 
-		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance) {
+		internal.Process(config, buildInstances, flags, log, func(buildInstance *build.Instance, cueInstance *cue.Instance, dirConfig *internal.Config) {
 			log.Debug("status command processing...")
-			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(cueInstance, flags, log)
+			stacksIterator, stacksIteratorErr := internal.NewStacksIterator(ctx, cueInstance, dirConfig, flags, log)
 			if stacksIteratorErr != nil {
 				log.Fatal(stacksIteratorErr)
 			}
@@ -41,7 +38,7 @@ If the stack does not exist status will return an error.
 				var stack internal.Stack
 				decodeErr := stackValue.Decode(&stack)
 				if decodeErr != nil {
-					log.Error(decodeErr)
+					log.Error(internal.StackError(decodeErr, buildInstance, stackValue))
 					continue
 				}
 
@@ -51,7 +48,7 @@ If the stack does not exist status will return an error.
 				// use a struct to pass a string, it's GC'd!
 				log.Debug("Describing", stack.Name)
 				describeStacksInput := cloudformation.DescribeStacksInput{StackName: aws.String(stack.Name)}
-				describeStacksOutput, describeStacksErr := cfn.DescribeStacks(context.TODO(), &describeStacksInput)
+				describeStacksOutput, describeStacksErr := cfn.DescribeStacks(ctx, &describeStacksInput)
 				log.Debugf("describeStacksOutput:\n%+v\n", describeStacksOutput)
 				if describeStacksErr != nil {
 					log.Error(describeStacksErr)
@@ -61,10 +58,7 @@ If the stack does not exist status will return an error.
 				describedStack := describeStacksOutput.Stacks[0]
 				status := string(describedStack.StackStatus)
 
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetAutoWrapText(false)
-				table.SetHeader([]string{"Stackname", "Status", "Created", "Updated", "Reason"})
-				table.SetHeaderColor(tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor}, tablewriter.Colors{tablewriter.FgWhiteColor})
+				table := log.NewTable("Stackname", "Status", "Created", "Updated", "Reason")
 
 				if strings.Contains(status, "FAIL") || strings.Contains(status, "ROLLBACK") {
 					status = au.Red(status).String()
@@ -0,0 +1,9 @@
+// Package core embeds the Cue schemas stacks are built upon so stax can evaluate them without a cue.mod
+package core
+
+import "embed"
+
+// Schemas holds the .cue files of package core
+//
+//go:embed *.cue
+var Schemas embed.FS
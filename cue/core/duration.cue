@@ -0,0 +1,4 @@
+package core
+
+// #Duration is a Go duration, eg: "30m" or "1h30m"
+#Duration: =~"^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"
@@ -0,0 +1,42 @@
+package core
+
+// #StackSettings is #Stack without the typed Template, stax embeds it to validate every stack before use
+#StackSettings: {
+	DependsOn?: [...string]
+	EnableTerminationProtection?: bool
+	// Environments and regions are declared in config.stax.cue, so any string is accepted here. stax validates
+	// Environment and Region against the config, and derives Region from RegionCode when omitted
+	Environment: string
+	Name:     string
+	NotificationARNs?: [...string]
+	// Overrides are keyed by a file path, a Systems Manager parameter name or path, or a Secrets Manager secret id
+	Overrides?:{
+		[string]: {
+			Source?: "file" | "sops" | "ssm" | "secretsmanager"
+			SopsProfile?: string
+			Profile?: string
+			Region?: string
+			Reference?: bool
+			Map?: {...}
+		}
+	}
+	Params?: {}
+	Profile:     string
+	Region?:     string
+	RegionCode?:  string
+	ResourcesToImport?: [string]: {
+		Identifier: [string]: string
+	}
+	Role?: =~"^arn:aws:iam::\\d{12}:role/[a-zA-Z0-9\\-_+=,.@]{1,64}$"
+	Template: {
+		AWSTemplateFormatVersion: _
+		...
+	}
+	Tags?: [string]: string
+	TagsEnabled: *true | false
+	// Timeouts override Cmd.Deploy.ChangeSetTimeout and Cmd.Deploy.StackTimeout of the config, eg: "30m"
+	Timeouts?: {
+		ChangeSet?: #Duration
+		Stack?:     #Duration
+	}
+}
@@ -4,9 +4,12 @@ go 1.16
 
 require (
 	cuelang.org/go v0.4.0
-	github.com/aws/aws-sdk-go-v2 v1.6.0
+	github.com/aws/aws-sdk-go-v2 v1.9.0
 	github.com/aws/aws-sdk-go-v2/config v1.3.0
 	github.com/aws/aws-sdk-go-v2/service/cloudformation v1.5.1
+	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.6.0
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.10.0
+	github.com/aws/smithy-go v1.8.0
 	github.com/deckarep/golang-set v1.7.1
 	github.com/ghodss/yaml v1.0.0
 	github.com/gonvenience/ytbx v1.2.2
@@ -19,4 +22,5 @@ require (
 	github.com/spf13/cobra v1.1.3
 	go.mozilla.org/sops/v3 v3.7.1
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.0-20210107172259-749611fa9fcc
 )
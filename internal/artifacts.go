@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue/build"
+)
+
+// file extensions of the artifacts written for a stack
+const (
+	TemplateYmlExtension    = ".cfn.yml"
+	TemplateJSONExtension   = ".cfn.json"
+	CliParametersExtension  = ".parameters.json"
+	TemplateConfigExtension = ".config.json"
+	OutputsExtension        = ".out.cue"
+)
+
+// StackArtifacts are the paths of the files written for a stack by export and save, as resolved by the config of the
+// stack's directory
+type StackArtifacts struct {
+	// ExportPath is the path of the exported template and parameters, without extension
+	ExportPath string
+	// Template is the exported template in the format of Cmd.Export.Format
+	Template string
+	// Parameters is the exported parameters in the format of Cmd.Export.Parameters, empty if not exported
+	Parameters string
+	// Outputs is the .out.cue file of the saved stack outputs
+	Outputs string
+}
+
+// GetStackArtifacts resolves the paths of the artifacts of stack, see Cmd.Export and Cmd.Save
+func GetStackArtifacts(config *Config, stack Stack, buildInstance *build.Instance) StackArtifacts {
+	replacer := strings.NewReplacer(
+		"${STX::Profile}", stack.Profile,
+		"${STX::Region}", stack.Region,
+		"${STX::RegionCode}", stack.RegionCode,
+		"${STX::Environment}", stack.Environment,
+		"${STX::Name}", stack.Name,
+		"${STX::CuePath}", strings.TrimPrefix(strings.Replace(buildInstance.Dir, buildInstance.Root, "", 1), "/"),
+	)
+
+	var artifacts StackArtifacts
+	artifacts.ExportPath = filepath.Clean(config.CueRoot + "/" + config.Cmd.Export.YmlPath + "/" + replacer.Replace(config.Cmd.Export.PathTemplate))
+
+	artifacts.Template = artifacts.ExportPath + TemplateYmlExtension
+	if config.Cmd.Export.Format == "json" {
+		artifacts.Template = artifacts.ExportPath + TemplateJSONExtension
+	}
+
+	switch config.Cmd.Export.Parameters {
+	case "cli":
+		artifacts.Parameters = artifacts.ExportPath + CliParametersExtension
+	case "template-configuration":
+		artifacts.Parameters = artifacts.ExportPath + TemplateConfigExtension
+	}
+
+	// OutFilePrefix may end with a separator to put outputs in a subdirectory
+	artifacts.Outputs = filepath.Clean(buildInstance.Dir + "/" + config.Cmd.Save.OutFilePrefix + stack.Name + OutputsExtension)
+
+	return artifacts
+}
+
+// Files returns every file that export and save may have written for the stack, in any format, so that none is left
+// behind after the format changed
+func (a StackArtifacts) Files() []string {
+	return []string{
+		a.ExportPath + TemplateYmlExtension,
+		a.ExportPath + TemplateJSONExtension,
+		a.ExportPath + CliParametersExtension,
+		a.ExportPath + TemplateConfigExtension,
+		a.Outputs,
+	}
+}
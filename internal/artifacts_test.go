@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"cuelang.org/go/cue/build"
+)
+
+func TestGetStackArtifacts(t *testing.T) {
+	stack := Stack{Name: "app-dev", Profile: "dev", Region: "us-west-2", RegionCode: "usw2", Environment: "dev"}
+	buildInstance := &build.Instance{Root: "/repo", Dir: "/repo/services/app"}
+
+	tests := []struct {
+		name                                              string
+		ymlPath, pathTemplate, format, parameters, prefix string
+		want                                              StackArtifacts
+	}{
+		{
+			name:         "defaults",
+			ymlPath:      "./yml",
+			pathTemplate: "${STX::Profile}/${STX::Name}",
+			format:       "yml",
+			want: StackArtifacts{
+				ExportPath: "/repo/yml/dev/app-dev",
+				Template:   "/repo/yml/dev/app-dev.cfn.yml",
+				Outputs:    "/repo/services/app/app-dev.out.cue",
+			},
+		},
+		{
+			name:         "json with cli parameters",
+			ymlPath:      "./yml",
+			pathTemplate: "${STX::Profile}/${STX::Name}",
+			format:       "json",
+			parameters:   "cli",
+			want: StackArtifacts{
+				ExportPath: "/repo/yml/dev/app-dev",
+				Template:   "/repo/yml/dev/app-dev.cfn.json",
+				Parameters: "/repo/yml/dev/app-dev.parameters.json",
+				Outputs:    "/repo/services/app/app-dev.out.cue",
+			},
+		},
+		{
+			name:         "template configuration",
+			ymlPath:      "out",
+			pathTemplate: "${STX::Environment}/${STX::RegionCode}/${STX::Name}",
+			format:       "yml",
+			parameters:   "template-configuration",
+			want: StackArtifacts{
+				ExportPath: "/repo/out/dev/usw2/app-dev",
+				Template:   "/repo/out/dev/usw2/app-dev.cfn.yml",
+				Parameters: "/repo/out/dev/usw2/app-dev.config.json",
+				Outputs:    "/repo/services/app/app-dev.out.cue",
+			},
+		},
+		{
+			name:         "cue path and region",
+			ymlPath:      "./yml",
+			pathTemplate: "${STX::CuePath}/${STX::Region}/${STX::Name}",
+			format:       "yml",
+			want: StackArtifacts{
+				ExportPath: "/repo/yml/services/app/us-west-2/app-dev",
+				Template:   "/repo/yml/services/app/us-west-2/app-dev.cfn.yml",
+				Outputs:    "/repo/services/app/app-dev.out.cue",
+			},
+		},
+		{
+			name:         "outputs in a subdirectory",
+			ymlPath:      "./yml",
+			pathTemplate: "${STX::Name}",
+			format:       "yml",
+			prefix:       "outputs/",
+			want: StackArtifacts{
+				ExportPath: "/repo/yml/app-dev",
+				Template:   "/repo/yml/app-dev.cfn.yml",
+				Outputs:    "/repo/services/app/outputs/app-dev.out.cue",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var config Config
+			config.CueRoot = "/repo"
+			config.Cmd.Export.YmlPath = test.ymlPath
+			config.Cmd.Export.PathTemplate = test.pathTemplate
+			config.Cmd.Export.Format = test.format
+			config.Cmd.Export.Parameters = test.parameters
+			config.Cmd.Save.OutFilePrefix = test.prefix
+
+			if got := GetStackArtifacts(&config, stack, buildInstance); got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestStackArtifactsFiles(t *testing.T) {
+	artifacts := StackArtifacts{ExportPath: "/repo/yml/app", Template: "/repo/yml/app.cfn.json", Outputs: "/repo/app/app.out.cue"}
+	want := []string{
+		"/repo/yml/app.cfn.yml",
+		"/repo/yml/app.cfn.json",
+		"/repo/yml/app.parameters.json",
+		"/repo/yml/app.config.json",
+		"/repo/app/app.out.cue",
+	}
+	if got := artifacts.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -4,16 +4,32 @@ import (
 	"context"
 	"log"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
-func GetCloudFormationClient(profile, region string) *cloudformation.Client {
+func getAWSConfig(profile, region string) aws.Config {
 	// Load the Shared AWS Configuration (~/.aws/config)
 	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region), config.WithSharedConfigProfile(profile))
 	if err != nil {
 		log.Fatal(err)
 	}
+	return cfg
+}
+
+func GetCloudFormationClient(profile, region string) *cloudformation.Client {
+	return cloudformation.NewFromConfig(getAWSConfig(profile, region))
+}
+
+// GetSSMClient returns a Systems Manager client for the profile and region
+func GetSSMClient(profile, region string) *ssm.Client {
+	return ssm.NewFromConfig(getAWSConfig(profile, region))
+}
 
-	return cloudformation.NewFromConfig(cfg)
+// GetSecretsManagerClient returns a Secrets Manager client for the profile and region
+func GetSecretsManagerClient(profile, region string) *secretsmanager.Client {
+	return secretsmanager.NewFromConfig(getAWSConfig(profile, region))
 }
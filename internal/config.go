@@ -1,33 +1,68 @@
 package internal
 
 import (
-	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
 	"github.com/cue-sh/stax/logger"
 )
 
 // Flags holds flags passed in from cli
 type Flags struct {
-	Environment, Profile, RegionCode, Exclude, Include, StackNameRegexPattern, Has, PrintPath, ImportStack, ImportRegion string
-	Debug, NoColor                                                                                                       bool
-	PrintOnlyErrors, PrintHideErrors, PrintOnlyNames, PrintHidePath, PrintOnlyPaths                                      bool
-	DeployWait, DeploySave, DeployDeps, DeployPrevious, DeployNoExecute, DeployExecuteOnly                               bool
+	Environment, Profile, RegionCode, Exclude, Include, StackNameRegexPattern, Has, PrintPath, ImportStack, ImportRegion, ImportStatus, DiffAgainst string
+	Debug, NoColor                                                                                                                                  bool
+	PrintOnlyErrors, PrintHideErrors, PrintOnlyNames, PrintHidePath, PrintOnlyPaths, PrintDefaults                                                  bool
+	DeployWait, DeploySave, DeployDeps, DeployPrevious, DeployNoExecute, DeployExecuteOnly                                                          bool
+	ImportResources, ImportAll                                                                                                                      bool
+	DiffExitCode, DiffSummary                                                                                                                       bool
+	DiffIgnore                                                                                                                                      []string
+	DeleteDeps                                                                                                                                      bool
+	DeleteRetainResources                                                                                                                           []string
+	DeleteConfirm                                                                                                                                   string
+	ExportStdout, ExportPrune, ExportCheck                                                                                                          bool
+	ExportFormat, ExportParameters                                                                                                                  string
+	Config, LogFormat, LogFile                                                                                                                      string
 }
 
+// configCue is the schema of config.stax.cue, it is compiled with the definitions of core/duration.cue in scope
 const configCue = `package stax
 PackageName: string | *"cfn"
 Cmd: {
-	Export: YmlPath: string | *"./yml"
+	Export: {
+		YmlPath:      string | *"./yml"
+		Format:       *"yml" | "json"
+		PathTemplate: string | *"${STX::Profile}/${STX::Name}"
+		Parameters:   *"" | "cli" | "template-configuration"
+	}
 	Save: {
-		OutFilePrefix: string | *""
+		OutFilePrefix:  string | *""
+		PackageName:    =~"^[a-zA-Z_][a-zA-Z0-9_]*$" | *"outputs"
+		CommaDelimited: [...string] | *[]
+	}
+	Deploy: {
+		ChangeSetTimeout: #Duration | *"10m"
+		StackTimeout:     #Duration | *"1h"
+		PollInterval:     #Duration | *"5s"
+		MaxPollInterval:  #Duration | *"1m"
 	}
 }
+Policies: {
+	Path: string | *"./policies"
+}
+Environments?: [...string]
+RegionCodes?: [string]: string
+StackSchema?: {...}
+StackDefaults?: {
+	Environments?: [string]: {...}
+	RegionCodes?: [string]: {...}
+	Paths?: [string]: {...}
+}
 `
 
 // Config holds config values parsed from config.stax.cue files
@@ -37,23 +72,54 @@ type Config struct {
 	PackageName string
 	Cmd         struct {
 		Export struct {
-			YmlPath string
+			YmlPath, Format, PathTemplate, Parameters string
 		}
 		Save struct {
-			OutFilePrefix string
+			OutFilePrefix, PackageName string
+			// CommaDelimited lists the output keys whose values are saved as lists
+			CommaDelimited []string
+		}
+		Deploy struct {
+			ChangeSetTimeout, StackTimeout, PollInterval, MaxPollInterval string
 		}
 	}
+	Policies struct {
+		Path string
+	}
+	// Environments and RegionCodes default to core.#Environments and core.#RegionCodes
+	Environments []string
+	RegionCodes  map[string]string
+	// StackSchema is unified with every stack, it is not decoded
+	StackSchema cue.Value `json:"-"`
+	// StackDefaults fill the fields the stacks they apply to leave unset, it is not decoded
+	StackDefaults cue.Value `json:"-"`
+	// Sources lists the config files and environment variables the config is composed of
+	Sources []string `json:"-"`
+	loader  *configLoader
+	value   cue.Value
 }
 
-// LoadConfig looks for config.stax.cue to be colocated with cue.mod and unifies that with a built-in default config schema
-func LoadConfig(log *logger.Logger) *Config {
+// LoadConfig looks for cue.mod from the working directory up and returns the config effective at the cue root,
+// composed of the built-in default config schema, ~/.stax/config.stax.cue, config.stax.cue colocated with cue.mod,
+// the file provided by --config and STAX_* environment variables. See Config.ForDir for per directory configs
+func LoadConfig(flags Flags, log *logger.Logger) *Config {
 	wd, _ := os.Getwd()
+	cfg, cfgErr := LoadConfigIn(wd, flags, log)
+	if cfgErr != nil {
+		log.Fatal(strings.Join(ErrorMessages(cfgErr), "\n"))
+		return nil
+	}
+	return cfg
+}
+
+// LoadConfigIn is LoadConfig for the cue.mod found from dir up, e.g. in a worktree of another revision
+func LoadConfigIn(dir string, flags Flags, log *logger.Logger) (*Config, error) {
 	separator := string(os.PathSeparator)
-	dirs := strings.Split(wd, separator)
+	dirs := strings.Split(dir, separator)
 	dirsLen := len(dirs)
 	usr, _ := user.Current()
 	var path string
-	// traverse the directory tree starting from PWD going up to successive parents
+	// traverse the directory tree starting from dir going up to successive parents
 	for i := dirsLen; i > 0; i-- {
 		path = strings.Join(dirs[:i], separator)
 		// look for the cue.mod filder
@@ -62,53 +128,71 @@ func LoadConfig(log *logger.Logger) *Config {
 		}
 	}
 
-	var buildInstances []*build.Instance
-	var cueInstances []*cue.Instance
-	var configInstance *cue.Instance
-	var configValue cue.Value
-	var buildArgs []string
-
-	// include baked-in cue config
-	configSchema := "/tmp/config.stax.cue"
-	ioutil.WriteFile(configSchema, []byte(configCue), 0766)
-	buildArgs = append(buildArgs, configSchema)
-
-	// look for global config in ~/.stax/config.stax.cue
-	homeConfigPath := filepath.Clean(usr.HomeDir + "/.stax/config.stax.cue")
-	if _, err := os.Stat(homeConfigPath); !os.IsNotExist(err) {
-		log.Debug("Global config found:", homeConfigPath)
-		buildArgs = append(buildArgs, homeConfigPath)
-	} else {
-		log.Debug("Global config NOT found:", homeConfigPath)
+	log.Debug("Building config...")
+	homeConfigPath := filepath.Clean(usr.HomeDir + "/.stax/" + configFileName)
+	loader, loaderErr := newConfigLoader(path, homeConfigPath, flags.Config, log)
+	if loaderErr != nil {
+		return nil, loaderErr
 	}
 
-	// look for config.stax.cue colocated with cue.mod
-	localConfigPath := path + "/config.stax.cue"
-	if _, err := os.Stat(localConfigPath); !os.IsNotExist(err) {
-		log.Debug("Local config found:", localConfigPath)
-		buildArgs = append(buildArgs, localConfigPath)
-	} else {
-		log.Debug("Local config NOT found:", localConfigPath)
+	cfg, cfgErr := loader.configFor(path)
+	if cfgErr != nil {
+		return nil, cfgErr
 	}
 
-	log.Debug("Building config...")
-	buildInstances = GetBuildInstances(buildArgs, "stax")
-	cueInstances = cue.Build(buildInstances)
-	configInstance = cueInstances[0]
-	configValue = configInstance.Value()
+	log.Debugf("Loaded config %+v\n", *cfg)
+	return cfg, nil
+}
+
+// ForDir returns the config effective in dir, which unifies the config.stax.cue files found in every directory
+// from cue.mod down to dir, the nearest one taking precedence
+func (c *Config) ForDir(dir string) (*Config, error) {
+	if c.loader == nil {
+		return c, nil
+	}
+	return c.loader.configFor(dir)
+}
 
-	configErr := configValue.Err()
-	if configErr != nil {
-		log.Fatal(configErr.Error())
+// Format returns the config as Cue
+func (c *Config) Format() ([]byte, error) {
+	syntax := c.value.Syntax(cue.Final(), cue.Concrete(true))
+	// unified fields come from the runtimes of the config files and cannot be filled into value
+	if configStruct, ok := syntax.(*ast.StructLit); ok {
+		for i, fieldValue := range []cue.Value{c.StackSchema, c.StackDefaults} {
+			field := unifiedConfigFields[i]
+			if !fieldValue.Exists() {
+				continue
+			}
+			if fieldSyntax, ok := fieldValue.Syntax(cue.Docs(true)).(ast.Expr); ok {
+				configStruct.Elts = append(configStruct.Elts, &ast.Field{Label: ast.NewIdent(field), Value: fieldSyntax})
+			}
+		}
 	}
+	return format.Node(syntax)
+}
 
-	cfg := Config{CueRoot: path, OsSeparator: separator}
+// GetRegionCode returns the code of the region as declared in RegionCodes, or "" if there is none.
+// When several codes declare the region, the first in alphabetical order is returned
+func (c *Config) GetRegionCode(region string) string {
+	var regionCodes []string
+	for regionCode := range c.RegionCodes {
+		regionCodes = append(regionCodes, regionCode)
+	}
+	sort.Strings(regionCodes)
+	for _, regionCode := range regionCodes {
+		if c.RegionCodes[regionCode] == region {
+			return regionCode
+		}
+	}
+	return ""
+}
 
-	log.Debug("Decoding config...")
-	decodeErr := configValue.Decode(&cfg)
-	if decodeErr != nil {
-		log.Fatal("Config decode error", decodeErr.Error())
+// IsEnvironment returns true if environment is declared in Environments
+func (c *Config) IsEnvironment(environment string) bool {
+	for _, configEnvironment := range c.Environments {
+		if configEnvironment == environment {
+			return true
+		}
 	}
-	log.Debugf("Loaded config %+v\n", cfg)
-	return &cfg
+	return false
 }
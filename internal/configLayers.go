@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/cue-sh/stax/logger"
+)
+
+// configFileName is the name of config files, next to cue.mod, in ~/.stax, or in any directory below cue.mod
+const configFileName = "config.stax.cue"
+
+// configEnvPrefix prefixes environment variables overriding config values, eg: STAX_CMD_EXPORT_YMLPATH
+const configEnvPrefix = "STAX_"
+
+// unifiedConfigFields are the config fields holding Cue constraints rather than concrete values,
+// they are unified across layers instead of replaced, and are not decoded
+var unifiedConfigFields = []string{"StackSchema", "StackDefaults"}
+
+// configLayer holds the values of a single config source
+type configLayer struct {
+	source  string
+	values  map[string]interface{}
+	unified map[string]cue.Value
+}
+
+// configLoader composes the config of a directory from, in increasing order of precedence:
+// the built-in defaults, ~/.stax/config.stax.cue, config.stax.cue next to cue.mod,
+// config.stax.cue in every directory from cue.mod down to the directory, --config, and STAX_* environment variables.
+// Concrete values of a layer replace those of the layers below it, StackSchema and StackDefaults of every layer are unified
+type configLoader struct {
+	cueRoot    string
+	base, top  []configLayer
+	dirLayers  map[string]*configLayer
+	dirConfigs map[string]*Config
+	schema     cue.Value
+	log        *logger.Logger
+}
+
+func newConfigLoader(cueRoot, homeConfigPath, configPath string, log *logger.Logger) (*configLoader, error) {
+	schema, schemaErr := compileWithDuration(configCue, "stax/"+configFileName)
+	if schemaErr != nil {
+		return nil, schemaErr
+	}
+	loader := configLoader{
+		cueRoot:    cueRoot,
+		dirLayers:  make(map[string]*configLayer),
+		dirConfigs: make(map[string]*Config),
+		schema:     schema,
+		log:        log,
+	}
+
+	for _, path := range []string{homeConfigPath, filepath.Join(cueRoot, configFileName)} {
+		layer, layerErr := loader.loadLayer(path)
+		if layerErr != nil {
+			return nil, layerErr
+		}
+		if layer != nil {
+			loader.base = append(loader.base, *layer)
+		}
+	}
+
+	if configPath != "" {
+		if _, statErr := os.Stat(configPath); statErr != nil {
+			return nil, statErr
+		}
+		layer, layerErr := loader.loadLayer(configPath)
+		if layerErr != nil {
+			return nil, layerErr
+		}
+		loader.top = append(loader.top, *layer)
+	}
+
+	envValues := make(map[string]interface{})
+	envValuesErr := loader.envValues(loader.schema, nil, envValues)
+	if envValuesErr != nil {
+		return nil, envValuesErr
+	}
+	if len(envValues) > 0 {
+		loader.top = append(loader.top, configLayer{source: configEnvPrefix + "* environment variables", values: envValues})
+	}
+
+	return &loader, nil
+}
+
+// loadLayer evaluates a config file, returns nil if it does not exist
+func (l *configLoader) loadLayer(path string) (*configLayer, error) {
+	if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+		l.log.Debug("Config NOT found:", path)
+		return nil, nil
+	}
+	l.log.Debug("Config found:", path)
+
+	buildInstances := GetBuildInstances([]string{path}, "stax")
+	if buildInstances[0].Err != nil {
+		return nil, buildInstances[0].Err
+	}
+	value := cue.Build(buildInstances)[0].Value()
+	if value.Err() != nil {
+		return nil, value.Err()
+	}
+	// report invalid values against the file rather than the merged config
+	validateErr := l.schema.Unify(value).Validate()
+	if validateErr != nil {
+		return nil, validateErr
+	}
+
+	values, valuesErr := concreteValues(value)
+	if valuesErr != nil {
+		return nil, fmt.Errorf("%s: %s", path, valuesErr)
+	}
+	layer := configLayer{source: path, values: values, unified: make(map[string]cue.Value)}
+	for _, field := range unifiedConfigFields {
+		if fieldValue := value.LookupPath(cue.ParsePath(field)); fieldValue.Exists() {
+			layer.unified[field] = fieldValue
+		}
+	}
+	return &layer, nil
+}
+
+// envValues sets the values of schema fields that have a matching STAX_* environment variable.
+// Lists of strings are comma separated
+func (l *configLoader) envValues(schema cue.Value, path []string, values map[string]interface{}) error {
+	fields, fieldsErr := schema.Fields(cue.Optional(true))
+	if fieldsErr != nil {
+		return fieldsErr
+	}
+	for fields.Next() {
+		label := fields.Label()
+		if len(path) == 0 && isUnifiedConfigField(label) {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), label)
+
+		switch fields.Value().IncompleteKind() {
+		case cue.StructKind:
+			fieldValues := make(map[string]interface{})
+			envValuesErr := l.envValues(fields.Value(), fieldPath, fieldValues)
+			if envValuesErr != nil {
+				return envValuesErr
+			}
+			if len(fieldValues) > 0 {
+				values[label] = fieldValues
+			}
+			continue
+		case cue.StringKind, cue.ListKind:
+		default:
+			continue
+		}
+
+		name := configEnvPrefix + strings.ToUpper(strings.Join(fieldPath, "_"))
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		l.log.Debug("Config from environment:", name)
+		if fields.Value().IncompleteKind() == cue.ListKind {
+			var list []interface{}
+			for _, item := range strings.Split(env, ",") {
+				list = append(list, strings.TrimSpace(item))
+			}
+			values[label] = list
+		} else {
+			values[label] = env
+		}
+	}
+	return nil
+}
+
+// dirLayer returns the layer of the config.stax.cue found in dir, nil if there is none
+func (l *configLoader) dirLayer(dir string) (*configLayer, error) {
+	if layer, ok := l.dirLayers[dir]; ok {
+		return layer, nil
+	}
+	layer, layerErr := l.loadLayer(filepath.Join(dir, configFileName))
+	if layerErr != nil {
+		return nil, layerErr
+	}
+	l.dirLayers[dir] = layer
+	return layer, nil
+}
+
+// configFor returns the config effective in dir
+func (l *configLoader) configFor(dir string) (*Config, error) {
+	dir = filepath.Clean(dir)
+	if cfg, ok := l.dirConfigs[dir]; ok {
+		return cfg, nil
+	}
+
+	layers := append([]configLayer{}, l.base...)
+	relative, relativeErr := filepath.Rel(l.cueRoot, dir)
+	if relativeErr == nil && relative != "." && !strings.HasPrefix(relative, "..") {
+		parent := l.cueRoot
+		for _, segment := range strings.Split(relative, string(os.PathSeparator)) {
+			parent = filepath.Join(parent, segment)
+			layer, layerErr := l.dirLayer(parent)
+			if layerErr != nil {
+				return nil, layerErr
+			}
+			if layer != nil {
+				layers = append(layers, *layer)
+			}
+		}
+	}
+	layers = append(layers, l.top...)
+
+	values := make(map[string]interface{})
+	unified := make(map[string]cue.Value)
+	var sources []string
+	for _, layer := range layers {
+		mergeValues(values, layer.values)
+		for field, fieldValue := range layer.unified {
+			if unifiedValue, ok := unified[field]; ok {
+				unified[field] = unifiedValue.Unify(fieldValue)
+			} else {
+				unified[field] = fieldValue
+			}
+		}
+		sources = append(sources, layer.source)
+	}
+	for _, fieldValue := range unified {
+		if fieldValue.Err() != nil {
+			return nil, fieldValue.Err()
+		}
+	}
+
+	value := l.schema.Unify(l.schema.Context().Encode(values))
+	if value.Err() != nil {
+		return nil, value.Err()
+	}
+
+	cfg := Config{CueRoot: l.cueRoot, OsSeparator: string(os.PathSeparator), Sources: sources, loader: l, value: value}
+	decodeErr := value.Decode(&cfg)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	if len(cfg.Environments) == 0 {
+		environments, environmentsErr := GetEnvironments()
+		if environmentsErr != nil {
+			return nil, environmentsErr
+		}
+		cfg.Environments = environments
+	}
+
+	if len(cfg.RegionCodes) == 0 {
+		regionCodes, regionCodesErr := GetRegionCodes()
+		if regionCodesErr != nil {
+			return nil, regionCodesErr
+		}
+		cfg.RegionCodes = regionCodes
+	}
+
+	cfg.StackSchema = unified["StackSchema"]
+	cfg.StackDefaults = unified["StackDefaults"]
+
+	l.dirConfigs[dir] = &cfg
+	return &cfg, nil
+}
+
+// concreteValues decodes the fields of a config value except the unified ones
+func concreteValues(value cue.Value) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	fields, fieldsErr := value.Fields()
+	if fieldsErr != nil {
+		return nil, fieldsErr
+	}
+	for fields.Next() {
+		label := fields.Label()
+		if isUnifiedConfigField(label) {
+			continue
+		}
+		var fieldValue interface{}
+		decodeErr := fields.Value().Decode(&fieldValue)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		values[label] = fieldValue
+	}
+	return values, nil
+}
+
+// mergeValues deep merges src into dst, values of src replace those of dst except for maps which are merged
+func mergeValues(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			merged := make(map[string]interface{})
+			mergeValues(merged, dstMap)
+			mergeValues(merged, srcMap)
+			dst[key] = merged
+			continue
+		}
+		dst[key] = srcValue
+	}
+}
+
+func isUnifiedConfigField(label string) bool {
+	for _, field := range unifiedConfigFields {
+		if label == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"github.com/cue-sh/stax/logger"
+)
+
+// writeConfigTree writes files, keyed by their path relative to a temporary cue root, and returns the cue root
+func writeConfigTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	cueRoot := t.TempDir()
+	files["cue.mod/module.cue"] = `module: "stax.test"`
+	for name, content := range files {
+		path := filepath.Join(cueRoot, name)
+		if mkdirErr := os.MkdirAll(filepath.Dir(path), 0755); mkdirErr != nil {
+			t.Fatal(mkdirErr)
+		}
+		if writeErr := os.WriteFile(path, []byte(content), 0644); writeErr != nil {
+			t.Fatal(writeErr)
+		}
+	}
+	return cueRoot
+}
+
+// setConfigEnv sets environment variables for the duration of the test
+func setConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for name, value := range env {
+		name := name
+		previous, existed := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if existed {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func newTestConfigLoader(t *testing.T, cueRoot, configPath string) *configLoader {
+	t.Helper()
+	loader, loaderErr := newConfigLoader(cueRoot, filepath.Join(cueRoot, "home", configFileName), configPath, logger.NewLogger(false, true))
+	if loaderErr != nil {
+		t.Fatal(loaderErr)
+	}
+	return loader
+}
+
+func TestConfigForPrecedence(t *testing.T) {
+	cueRoot := writeConfigTree(t, map[string]string{
+		"home/" + configFileName: `package stax
+PackageName: "home"
+Cmd: Save: OutFilePrefix: "home-"
+Environments: ["qa"]
+RegionCodes: use1: "us-east-1"
+`,
+		configFileName: `package stax
+PackageName: "root"
+Cmd: Export: YmlPath: "./root"
+Cmd: Export: Format: "json"
+RegionCodes: usw2: "us-west-2"
+`,
+		"app/" + configFileName: `package stax
+Cmd: Export: YmlPath: "./app"
+Environments: ["qa", "live"]
+`,
+		"app/web/" + configFileName: `package stax
+Cmd: Deploy: StackTimeout: "2h"
+`,
+		"app/web/api/stack.cue": `package cfn`,
+		"other/" + configFileName: `package stax
+Cmd: Export: YmlPath: "./other"
+`,
+		"override/" + configFileName: `package stax
+Cmd: Export: YmlPath: "./override"
+Cmd: Export: Format: "yml"
+`,
+	})
+	setConfigEnv(t, map[string]string{"STAX_CMD_EXPORT_YMLPATH": "./env"})
+
+	tests := []struct {
+		name, dir, configPath string
+		values                func(cfg *Config) []interface{}
+		want                  []interface{}
+		sources               []string
+	}{
+		{
+			name: "cue root",
+			dir:  cueRoot,
+			values: func(cfg *Config) []interface{} {
+				return []interface{}{cfg.PackageName, cfg.Cmd.Save.OutFilePrefix, cfg.Cmd.Export.YmlPath, cfg.Cmd.Export.Format, cfg.Environments, cfg.RegionCodes}
+			},
+			// the environment variable wins over every file
+			want:    []interface{}{"root", "home-", "./env", "json", []string{"qa"}, map[string]string{"use1": "us-east-1", "usw2": "us-west-2"}},
+			sources: []string{"home/" + configFileName, configFileName, "STAX_* environment variables"},
+		},
+		{
+			name: "nested directory",
+			dir:  filepath.Join(cueRoot, "app", "web", "api"),
+			values: func(cfg *Config) []interface{} {
+				return []interface{}{cfg.PackageName, cfg.Cmd.Export.YmlPath, cfg.Cmd.Export.Format, cfg.Cmd.Deploy.StackTimeout, cfg.Cmd.Deploy.PollInterval, cfg.Environments}
+			},
+			// directories replace the values of the root and their parents, defaults fill the rest
+			want:    []interface{}{"root", "./env", "json", "2h", "5s", []string{"qa", "live"}},
+			sources: []string{"home/" + configFileName, configFileName, "app/" + configFileName, "app/web/" + configFileName, "STAX_* environment variables"},
+		},
+		{
+			name: "sibling directory",
+			dir:  filepath.Join(cueRoot, "other"),
+			values: func(cfg *Config) []interface{} {
+				return []interface{}{cfg.Cmd.Deploy.StackTimeout, cfg.Environments}
+			},
+			want:    []interface{}{"1h", []string{"qa"}},
+			sources: []string{"home/" + configFileName, configFileName, "other/" + configFileName, "STAX_* environment variables"},
+		},
+		{
+			name:       "--config above directories",
+			dir:        filepath.Join(cueRoot, "app"),
+			configPath: filepath.Join(cueRoot, "override", configFileName),
+			values: func(cfg *Config) []interface{} {
+				return []interface{}{cfg.Cmd.Export.YmlPath, cfg.Cmd.Export.Format, cfg.Environments}
+			},
+			want:    []interface{}{"./env", "yml", []string{"qa", "live"}},
+			sources: []string{"home/" + configFileName, configFileName, "app/" + configFileName, "override/" + configFileName, "STAX_* environment variables"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, cfgErr := newTestConfigLoader(t, cueRoot, test.configPath).configFor(test.dir)
+			if cfgErr != nil {
+				t.Fatal(cfgErr)
+			}
+			if got := test.values(cfg); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			var sources []string
+			for _, source := range cfg.Sources {
+				sources = append(sources, strings.TrimPrefix(source, cueRoot+string(os.PathSeparator)))
+			}
+			if !reflect.DeepEqual(sources, test.sources) {
+				t.Errorf("expected sources %v, got %v", test.sources, sources)
+			}
+		})
+	}
+}
+
+func TestConfigForUnifiedFields(t *testing.T) {
+	cueRoot := writeConfigTree(t, map[string]string{
+		configFileName: `package stax
+Environments: ["qa"]
+StackSchema: Tags: Team: string | *"platform"
+StackDefaults: Environments: qa: Tags: CostCenter: "1"
+`,
+		"app/" + configFileName: `package stax
+StackSchema: Tags: Team: "data" | "platform"
+StackDefaults: Paths: "^app$": Profile: "app"
+`,
+		"conflict/" + configFileName: `package stax
+StackSchema: Tags: Team: 1
+`,
+	})
+	loader := newTestConfigLoader(t, cueRoot, "")
+
+	cfg, cfgErr := loader.configFor(filepath.Join(cueRoot, "app"))
+	if cfgErr != nil {
+		t.Fatal(cfgErr)
+	}
+
+	// constraints of every layer apply, the default of the root survives
+	team := cfg.StackSchema.LookupPath(cue.ParsePath("Tags.Team"))
+	if unified := team.Unify(team.Context().CompileString(`"data"`)); unified.Err() != nil {
+		t.Errorf("expected data to be allowed, got %v", unified.Err())
+	}
+	if unified := team.Unify(team.Context().CompileString(`"web"`)); unified.Err() == nil {
+		t.Error("expected web to be rejected by the app directory's schema")
+	}
+	if teamDefault, _ := team.Default(); teamDefault.Kind() != cue.StringKind {
+		t.Errorf("expected a string default, got %v", teamDefault)
+	} else if defaultTeam, _ := teamDefault.String(); defaultTeam != "platform" {
+		t.Errorf("expected the default platform, got %s", defaultTeam)
+	}
+
+	// defaults of every layer are kept side by side
+	for _, path := range []string{`Environments.qa.Tags.CostCenter`, `Paths."^app$".Profile`} {
+		if !cfg.StackDefaults.LookupPath(cue.ParsePath(path)).Exists() {
+			t.Errorf("expected StackDefaults.%s", path)
+		}
+	}
+
+	// the root config is not affected by the app directory
+	rootCfg, rootCfgErr := loader.configFor(cueRoot)
+	if rootCfgErr != nil {
+		t.Fatal(rootCfgErr)
+	}
+	if rootCfg.StackDefaults.LookupPath(cue.ParsePath(`Paths."^app$"`)).Exists() {
+		t.Error("expected no Paths defaults at the cue root")
+	}
+
+	if _, conflictErr := loader.configFor(filepath.Join(cueRoot, "conflict")); conflictErr == nil {
+		t.Error("expected conflicting StackSchema layers to fail")
+	}
+}
+
+func TestConfigEnvValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		value   func(cfg *Config) interface{}
+		wantErr bool
+		want    interface{}
+	}{
+		{
+			name:  "top level string",
+			env:   map[string]string{"STAX_PACKAGENAME": "env"},
+			value: func(cfg *Config) interface{} { return cfg.PackageName },
+			want:  "env",
+		},
+		{
+			name:  "nested string",
+			env:   map[string]string{"STAX_CMD_DEPLOY_STACKTIMEOUT": "90m"},
+			value: func(cfg *Config) interface{} { return cfg.Cmd.Deploy.StackTimeout },
+			want:  "90m",
+		},
+		{
+			name:  "comma separated list",
+			env:   map[string]string{"STAX_ENVIRONMENTS": "qa, live,dev"},
+			value: func(cfg *Config) interface{} { return cfg.Environments },
+			want:  []string{"qa", "live", "dev"},
+		},
+		{
+			name:  "nested list",
+			env:   map[string]string{"STAX_CMD_SAVE_COMMADELIMITED": "Subnets,Zones"},
+			value: func(cfg *Config) interface{} { return cfg.Cmd.Save.CommaDelimited },
+			want:  []string{"Subnets", "Zones"},
+		},
+		{
+			name:  "file value kept without variable",
+			env:   map[string]string{"STAX_CMD_EXPORT_FORMAT": "json"},
+			value: func(cfg *Config) interface{} { return cfg.Cmd.Export.YmlPath },
+			want:  "./file",
+		},
+		{
+			name:    "value outside an enum",
+			env:     map[string]string{"STAX_CMD_EXPORT_FORMAT": "xml"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"STAX_CMD_DEPLOY_POLLINTERVAL": "soon"},
+			wantErr: true,
+		},
+		{
+			name:  "unified fields are not read",
+			env:   map[string]string{"STAX_STACKSCHEMA": "x"},
+			value: func(cfg *Config) interface{} { return cfg.StackSchema.Exists() },
+			want:  false,
+		},
+	}
+
+	cueRoot := writeConfigTree(t, map[string]string{
+		configFileName: `package stax
+Environments: ["qa"]
+Cmd: Export: YmlPath: "./file"
+`,
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setConfigEnv(t, test.env)
+			// invalid values may be reported by the loader or when the config is composed
+			loader, loaderErr := newConfigLoader(cueRoot, filepath.Join(cueRoot, "home", configFileName), "", logger.NewLogger(false, true))
+			if loaderErr != nil {
+				if !test.wantErr {
+					t.Fatal(loaderErr)
+				}
+				return
+			}
+			cfg, cfgErr := loader.configFor(cueRoot)
+			if test.wantErr {
+				if cfgErr == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if cfgErr != nil {
+				t.Fatal(cfgErr)
+			}
+			if got := test.value(cfg); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	dst := map[string]interface{}{
+		"PackageName":  "root",
+		"Cmd":          map[string]interface{}{"Export": map[string]interface{}{"YmlPath": "./root", "Format": "json"}},
+		"RegionCodes":  map[string]interface{}{"use1": "us-east-1"},
+		"Environments": []interface{}{"qa", "live"},
+	}
+	src := map[string]interface{}{
+		"Cmd":          map[string]interface{}{"Export": map[string]interface{}{"YmlPath": "./app"}},
+		"RegionCodes":  map[string]interface{}{"usw2": "us-west-2"},
+		"Environments": []interface{}{"dev"},
+	}
+	want := map[string]interface{}{
+		"PackageName": "root",
+		"Cmd":         map[string]interface{}{"Export": map[string]interface{}{"YmlPath": "./app", "Format": "json"}},
+		"RegionCodes": map[string]interface{}{"use1": "us-east-1", "usw2": "us-west-2"},
+		// lists are replaced, not appended
+		"Environments": []interface{}{"dev"},
+	}
+
+	mergeValues(dst, src)
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("expected %v, got %v", want, dst)
+	}
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueErrors "cuelang.org/go/cue/errors"
+	"github.com/cue-sh/stax/cue/core"
+)
+
+// getCoreDefinition evaluates a single file of the embedded core schemas and returns the definition
+func getCoreDefinition(file, definition string) (cue.Value, error) {
+	src, readErr := core.Schemas.ReadFile(file)
+	if readErr != nil {
+		return cue.Value{}, readErr
+	}
+
+	value := cuecontext.New().CompileBytes(src, cue.Filename(file))
+	if value.Err() != nil {
+		return cue.Value{}, value.Err()
+	}
+
+	definitionValue := value.LookupPath(cue.ParsePath(definition))
+	if !definitionValue.Exists() {
+		return cue.Value{}, fmt.Errorf("%s is not defined in %s", definition, file)
+	}
+	return definitionValue, nil
+}
+
+// compileWithDuration compiles src with core.#Duration in scope, so the config and the stacks share one definition
+func compileWithDuration(src, filename string) (cue.Value, error) {
+	ctx := cuecontext.New()
+	durationSrc, readErr := core.Schemas.ReadFile("duration.cue")
+	if readErr != nil {
+		return cue.Value{}, readErr
+	}
+	duration := ctx.CompileBytes(durationSrc, cue.Filename("duration.cue"))
+	if duration.Err() != nil {
+		return cue.Value{}, duration.Err()
+	}
+	value := ctx.CompileString(src, cue.Filename(filename), cue.Scope(duration))
+	return value, value.Err()
+}
+
+// GetRegionCodes returns the #RegionCodes map of region code to region
+func GetRegionCodes() (map[string]string, error) {
+	regionCodes := make(map[string]string)
+	regionCodesValue, regionCodesErr := getCoreDefinition("regions.cue", "#RegionCodes")
+	if regionCodesErr != nil {
+		return nil, regionCodesErr
+	}
+	decodeErr := regionCodesValue.Decode(&regionCodes)
+	return regionCodes, decodeErr
+}
+
+// GetEnvironments returns the list of #Environments
+func GetEnvironments() ([]string, error) {
+	var environments []string
+	environmentsValue, environmentsErr := getCoreDefinition("environments.cue", "#Environments")
+	if environmentsErr != nil {
+		return nil, environmentsErr
+	}
+	decodeErr := environmentsValue.Decode(&environments)
+	return environments, decodeErr
+}
+
+// stackSettings caches core.#StackSettings by the schema declarations it was compiled with
+var stackSettings = make(map[string]cue.Value)
+var stackSettingsMutex sync.Mutex
+
+// getStackSettings returns core.#StackSettings with Environment and Region constrained to the Environments and
+// RegionCodes of config. The published schema accepts any string so that configured names evaluate in user packages
+func getStackSettings(config *Config) (cue.Value, error) {
+	var regions []string
+	for _, region := range config.RegionCodes {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	environmentsJSON, environmentsErr := json.Marshal(config.Environments)
+	if environmentsErr != nil {
+		return cue.Value{}, environmentsErr
+	}
+	regionsJSON, regionsErr := json.Marshal(regions)
+	if regionsErr != nil {
+		return cue.Value{}, regionsErr
+	}
+	schemas := fmt.Sprintf("#StackSettings: Environment: or(%s)\n#StackSettings: Region: or(%s)\n", environmentsJSON, regionsJSON)
+
+	stackSettingsMutex.Lock()
+	defer stackSettingsMutex.Unlock()
+	if settings, ok := stackSettings[schemas]; ok {
+		return settings, nil
+	}
+
+	src, readErr := core.Schemas.ReadFile("settings.cue")
+	if readErr != nil {
+		return cue.Value{}, readErr
+	}
+	value, compileErr := compileWithDuration(string(src)+"\n"+schemas, "settings.cue")
+	if compileErr != nil {
+		return cue.Value{}, compileErr
+	}
+	settings := value.LookupPath(cue.ParsePath("#StackSettings"))
+	stackSettings[schemas] = settings
+	return settings, nil
+}
+
+// ValidateStack unifies stackValue with the embedded core.#StackSettings, with Environment and Region constrained to
+// the Environments and RegionCodes of config, and returns the unified value, along with the schema violations and the
+// fields that are not concrete
+func ValidateStack(config *Config, stackValue cue.Value) (cue.Value, error) {
+	settings, settingsErr := getStackSettings(config)
+	if settingsErr != nil {
+		return stackValue, settingsErr
+	}
+
+	if region, _ := stackValue.LookupPath(cue.ParsePath("Region")).String(); region == "" {
+		return stackValue, errors.New("Region is undefined, set Region or RegionCode")
+	}
+
+	stackValue = stackValue.Unify(settings)
+	validateErr := stackValue.Validate(cue.Concrete(true))
+	if validateErr != nil {
+		return stackValue, validateErr
+	}
+	return stackValue, ambiguousValues(stackValue)
+}
+
+// ambiguousValues returns an error for every field of value whose disjunction has more than one default, such as
+// *false | true unified with *true | false. Validate accepts them, but they cannot be decoded
+func ambiguousValues(value cue.Value) error {
+	var ambiguousErr cueErrors.Error
+	value.Walk(func(fieldValue cue.Value) bool {
+		if defaultValue, ok := fieldValue.Default(); ok && defaultValue.Err() != nil {
+			ambiguousErr = cueErrors.Append(ambiguousErr, cueErrors.Newf(fieldValue.Pos(), "%s: ambiguous value %v, more than one default applies", fieldValue.Path(), fieldValue))
+			return false
+		}
+		return true
+	}, nil)
+	if ambiguousErr == nil {
+		return nil
+	}
+	return ambiguousErr
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	cueErrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+	"github.com/cue-sh/stax/logger"
+)
+
+// stackError is an error raised while handling a stack value
+type stackError struct {
+	path, stackName string
+	err             error
+	fallback        token.Pos
+}
+
+// StackError ties err to the build instance and stack it was raised for, so the message reads
+// "path stack: error file:line:column" for every underlying Cue error.
+// When err carries no source position, the position of stackValue is used instead
+func StackError(err error, buildInstance *build.Instance, stackValue cue.Value) error {
+	if err == nil {
+		return nil
+	}
+	stackName, _ := stackValue.Label()
+	var path string
+	if buildInstance != nil {
+		path = buildInstance.DisplayPath
+	}
+	return &stackError{path: path, stackName: stackName, err: err, fallback: stackValue.Pos()}
+}
+
+func (e *stackError) Error() string {
+	var prefix []string
+	if e.path != "" {
+		prefix = append(prefix, e.path)
+	}
+	if e.stackName != "" {
+		prefix = append(prefix, e.stackName)
+	}
+
+	messages := ErrorMessages(e.err)
+	if len(cueErrors.Positions(e.err)) == 0 && e.fallback.IsValid() {
+		for i := range messages {
+			messages[i] += " " + RelativePosition(e.fallback)
+		}
+	}
+
+	if len(prefix) == 0 {
+		return strings.Join(messages, "\n")
+	}
+	return strings.Join(prefix, " ") + ": " + strings.Join(messages, "\n  ")
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// ErrorMessages expands err into one message per underlying Cue error, each followed by its source positions
+func ErrorMessages(err error) []string {
+	var messages []string
+	for _, cueErr := range cueErrors.Errors(err) {
+		message := cueErrors.String(cueErr)
+		for _, pos := range cueErrors.Positions(cueErr) {
+			message += " " + RelativePosition(pos)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// RelativePosition formats pos as file:line:column with the file relative to the working directory
+func RelativePosition(pos token.Pos) string {
+	if !pos.IsValid() {
+		return "-"
+	}
+	position := pos.Position()
+	if wd, wdErr := os.Getwd(); wdErr == nil {
+		if relative, relativeErr := filepath.Rel(wd, position.Filename); relativeErr == nil {
+			position.Filename = relative
+		}
+	}
+	return position.String()
+}
+
+// awsAuthErrorCodes are the codes of AWS API errors caused by missing, expired or insufficient credentials
+var awsAuthErrorCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"SignatureDoesNotMatch":       true,
+	"UnrecognizedClientException": true,
+}
+
+// ExitCode returns the exit code of err: logger.ExitCancelled for calls interrupted by the user, logger.ExitTimeout
+// for waiters that timed out, logger.ExitAWSAuth when AWS credentials could not be retrieved or were
+// rejected, logger.ExitValidation for Cue errors, and logger.ExitError otherwise
+func ExitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return logger.ExitCancelled
+	}
+	var timeoutErr *WaitTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return logger.ExitTimeout
+	}
+	var signingErr *v4.SigningError
+	if errors.As(err, &signingErr) {
+		return logger.ExitAWSAuth
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && awsAuthErrorCodes[apiErr.ErrorCode()] {
+		return logger.ExitAWSAuth
+	}
+	var cueErr cueErrors.Error
+	if errors.As(err, &cueErr) {
+		return logger.ExitValidation
+	}
+	return logger.ExitError
+}
+
+// IsStackNotFound returns true if err is the ValidationError the CloudFormation API returns for a stack that does not
+// exist, as opposed to any other API or transport error
+func IsStackNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.ErrorCode() == "ValidationError" && strings.HasSuffix(apiErr.ErrorMessage(), "does not exist")
+}
+
+// IsTransient returns true for errors the AWS SDK retries by default, such as throttling, 5xx responses and connection
+// errors, which may succeed when the call is made again later
+func IsTransient(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
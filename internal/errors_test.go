@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name                     string
+		err                      error
+		transient, stackNotFound bool
+	}{
+		{
+			name:      "throttling",
+			err:       &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"},
+			transient: true,
+		},
+		{
+			name:      "wrapped throttling",
+			err:       fmt.Errorf("describe stacks: %w", &smithy.GenericAPIError{Code: "RequestLimitExceeded"}),
+			transient: true,
+		},
+		{
+			name:          "stack not found",
+			err:           &smithy.GenericAPIError{Code: "ValidationError", Message: "Stack with id app does not exist"},
+			stackNotFound: true,
+		},
+		{
+			name: "other validation error",
+			err:  &smithy.GenericAPIError{Code: "ValidationError", Message: "Template format error"},
+		},
+		{
+			name: "access denied",
+			err:  &smithy.GenericAPIError{Code: "AccessDenied"},
+		},
+		{
+			name: "cancelled",
+			err:  context.Canceled,
+		},
+		{
+			name: "plain error mentioning a missing stack",
+			err:  errors.New("stack does not exist"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsTransient(test.err); got != test.transient {
+				t.Errorf("IsTransient: expected %t, got %t", test.transient, got)
+			}
+			if got := IsStackNotFound(test.err); got != test.stackNotFound {
+				t.Errorf("IsStackNotFound: expected %t, got %t", test.stackNotFound, got)
+			}
+		})
+	}
+}
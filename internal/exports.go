@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// GetExportImporters returns the names of the stacks importing each export of stack, keyed by export name.
+// Exports that are not imported are left out
+func GetExportImporters(ctx context.Context, cfn *cloudformation.Client, stack types.Stack) (map[string][]string, error) {
+	importers := make(map[string][]string)
+	for _, output := range stack.Outputs {
+		exportName := aws.ToString(output.ExportName)
+		if exportName == "" {
+			continue
+		}
+
+		paginator := cloudformation.NewListImportsPaginator(cfn, &cloudformation.ListImportsInput{ExportName: aws.String(exportName)})
+		for paginator.HasMorePages() {
+			page, pageErr := paginator.NextPage(ctx)
+			if pageErr != nil {
+				if strings.Contains(pageErr.Error(), "is not imported by any stack") {
+					break
+				}
+				return nil, pageErr
+			}
+			importers[exportName] = append(importers[exportName], page.Imports...)
+		}
+	}
+	return importers, nil
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitWorktree is a temporary checkout of another revision of the repository containing the cue root
+type GitWorktree struct {
+	// Dir is the root of the temporary checkout
+	Dir string
+	// TopLevel is the root of the repository the worktree was created from
+	TopLevel string
+}
+
+// NewGitWorktree checks out ref into a temporary, detached git worktree of the repository containing dir.
+// cue.mod folders that are not committed (pkg, gen, usr) are linked from dir so the revision can be evaluated
+func NewGitWorktree(dir, ref string) (*GitWorktree, error) {
+	topLevel, topLevelErr := git(dir, "rev-parse", "--show-toplevel")
+	if topLevelErr != nil {
+		return nil, topLevelErr
+	}
+
+	worktreeDir, tempDirErr := ioutil.TempDir("", "stax-worktree-")
+	if tempDirErr != nil {
+		return nil, tempDirErr
+	}
+
+	_, worktreeErr := git(topLevel, "worktree", "add", "--detach", worktreeDir, ref)
+	if worktreeErr != nil {
+		os.RemoveAll(worktreeDir)
+		return nil, worktreeErr
+	}
+
+	worktree := &GitWorktree{Dir: worktreeDir, TopLevel: topLevel}
+
+	cueMod, cueModErr := worktree.Path(filepath.Join(dir, "cue.mod"))
+	if cueModErr == nil {
+		for _, folder := range []string{"pkg", "gen", "usr"} {
+			source := filepath.Join(dir, "cue.mod", folder)
+			target := filepath.Join(cueMod, folder)
+			if _, err := os.Stat(source); os.IsNotExist(err) {
+				continue
+			}
+			if _, err := os.Stat(target); os.IsNotExist(err) {
+				symlinkErr := os.Symlink(source, target)
+				if symlinkErr != nil {
+					worktree.Remove()
+					return nil, symlinkErr
+				}
+			}
+		}
+	}
+
+	return worktree, nil
+}
+
+// Path returns the path within the worktree that corresponds to path within the repository
+func (w *GitWorktree) Path(path string) (string, error) {
+	absPath, absErr := filepath.Abs(path)
+	if absErr != nil {
+		return "", absErr
+	}
+	// resolve symlinks as git does for --show-toplevel
+	if evaluated, evalErr := filepath.EvalSymlinks(absPath); evalErr == nil {
+		absPath = evaluated
+	}
+	relPath, relErr := filepath.Rel(w.TopLevel, absPath)
+	if relErr != nil {
+		return "", relErr
+	}
+	return filepath.Join(w.Dir, relPath), nil
+}
+
+// Remove deletes the worktree
+func (w *GitWorktree) Remove() error {
+	_, removeErr := git(w.TopLevel, "worktree", "remove", "--force", w.Dir)
+	return removeErr
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
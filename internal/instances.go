@@ -3,6 +3,7 @@ package internal
 import (
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
@@ -12,13 +13,26 @@ import (
 	"github.com/cue-sh/stax/logger"
 )
 
-type instanceHandler func(*build.Instance, *cue.Instance)
+// instanceHandler handles a build instance along with the config effective in its directory
+type instanceHandler func(*build.Instance, *cue.Instance, *Config)
+
+// ResolveOverridePath returns the path of the overrides file declared by key in Stacks[stackname].Overrides
+func ResolveOverridePath(key string, buildInstance *build.Instance) string {
+	path := strings.Replace(key, "${STX::CuePath}", strings.Replace(buildInstance.Dir, buildInstance.Root+"/", "", 1), 1)
+	return filepath.Clean(buildInstance.Root + "/" + path)
+}
 
 // GetBuildInstances loads and parses cue files and returns a list of build instances
 func GetBuildInstances(args []string, pkg string) []*build.Instance {
+	return GetBuildInstancesIn("", args, pkg)
+}
+
+// GetBuildInstancesIn loads and parses cue files relative to dir and returns a list of build instances
+func GetBuildInstancesIn(dir string, args []string, pkg string) []*build.Instance {
 	// const syntaxVersion = -1000 + 13
 
 	config := load.Config{
+		Dir:     dir,
 		Package: pkg,
 		Context: build.NewContext(
 			build.ParseFile(func(name string, src interface{}) (*ast.File, error) {
@@ -38,7 +52,8 @@ func GetBuildInstances(args []string, pkg string) []*build.Instance {
 	return buildInstances
 }
 
-// Process iterates over instances, filters based on flags, and applies the handler function for each
+// Process iterates over instances, filters based on flags, and applies the handler function for each along with the
+// config of the instance's directory, see Config.ForDir
 func Process(config *Config, buildInstances []*build.Instance, flags Flags, log *logger.Logger, handler instanceHandler) {
 
 	var excludeRegexp, includeRegexp *regexp.Regexp
@@ -92,12 +107,23 @@ func Process(config *Config, buildInstances []*build.Instance, flags Flags, log
 		cueInstance := cue.Build([]*build.Instance{buildInstance})[0]
 		if cueInstance.Err != nil {
 			// parse errors will be exposed here
-			log.Error(cueInstance.Err, cueInstance.Err.Position())
+			messages := strings.Join(ErrorMessages(cueInstance.Err), "\n  ")
+			if buildInstance.DisplayPath != "" {
+				messages = buildInstance.DisplayPath + ": " + messages
+			}
+			log.Error(messages)
 			// TODO consider using log.Fatal and removing continue
 			continue
 		}
 
+		// the nearest config.stax.cue applies to the stacks of the instance
+		dirConfig, dirConfigErr := config.ForDir(buildInstance.Dir)
+		if dirConfigErr != nil {
+			log.Error(buildInstance.DisplayPath + ": " + strings.Join(ErrorMessages(dirConfigErr), "\n  "))
+			continue
+		}
+
 		log.Debug("Executing handler...")
-		handler(buildInstance, cueInstance)
+		handler(buildInstance, cueInstance, dirConfig)
 	}
 }
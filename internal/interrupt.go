@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cue-sh/stax/logger"
+)
+
+// NewInterruptContext returns a context that is cancelled on the first interrupt, so that commands stop starting
+// new stacks and may clean up the ones in progress. The second interrupt exits immediately
+func NewInterruptContext(log *logger.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Warn("\nInterrupted, stopping after the current step. Interrupt again to exit immediately.")
+		log.SetExitCode(logger.ExitCancelled)
+		cancel()
+
+		<-signals
+		log.Close()
+		os.Exit(logger.ExitCancelled)
+	}()
+
+	return ctx
+}
+
+// Sleep waits for d unless ctx is done first, in which case it returns the context error
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
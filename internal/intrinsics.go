@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExpandShortIntrinsics converts the short form intrinsic functions of a yml template (!Ref, !Sub, !GetAtt...)
+// into their long form equivalents (Ref:, Fn::Sub:, Fn::GetAtt:...) so the template can be compared as plain yml
+func ExpandShortIntrinsics(templateBody []byte) ([]byte, error) {
+	var document yaml.Node
+	unmarshalErr := yaml.Unmarshal(templateBody, &document)
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	expandShortIntrinsic(&document)
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	encodeErr := encoder.Encode(&document)
+	if encodeErr != nil {
+		return nil, encodeErr
+	}
+	return buffer.Bytes(), nil
+}
+
+func expandShortIntrinsic(node *yaml.Node) {
+	for _, child := range node.Content {
+		expandShortIntrinsic(child)
+	}
+
+	// local tags start with a single !, the core schema tags (!!str, !!map...) with two
+	if !strings.HasPrefix(node.Tag, "!") || strings.HasPrefix(node.Tag, "!!") {
+		return
+	}
+
+	function := strings.TrimPrefix(node.Tag, "!")
+	if function != "Ref" && function != "Condition" {
+		function = "Fn::" + function
+	}
+
+	value := *node
+	value.Tag = ""
+	value.Style &^= yaml.TaggedStyle
+	if value.Kind == yaml.ScalarNode {
+		value.Tag = "!!str"
+	}
+
+	// !GetAtt Resource.Attribute is the short form of Fn::GetAtt: [Resource, Attribute]
+	if function == "Fn::GetAtt" && value.Kind == yaml.ScalarNode {
+		parts := strings.SplitN(value.Value, ".", 2)
+		value = yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, part := range parts {
+			value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part})
+		}
+	}
+
+	*node = yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: function},
+			&value,
+		},
+		Line:   node.Line,
+		Column: node.Column,
+	}
+}
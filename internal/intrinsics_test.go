@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandShortIntrinsics(t *testing.T) {
+	tests := []struct {
+		name, template, want string
+	}{
+		{
+			name:     "ref",
+			template: "Value: !Ref Bucket",
+			want:     "Value: {Ref: Bucket}",
+		},
+		{
+			name:     "condition",
+			template: "Value: !Condition IsProd",
+			want:     "Value: {Condition: IsProd}",
+		},
+		{
+			name:     "sub",
+			template: "Value: !Sub '${AWS::Region}-bucket'",
+			want:     "Value: {Fn::Sub: '${AWS::Region}-bucket'}",
+		},
+		{
+			name:     "getatt scalar",
+			template: "Value: !GetAtt Bucket.Arn",
+			want:     "Value: {Fn::GetAtt: [Bucket, Arn]}",
+		},
+		{
+			name:     "getatt nested attribute",
+			template: "Value: !GetAtt Database.Endpoint.Address",
+			want:     "Value: {Fn::GetAtt: [Database, Endpoint.Address]}",
+		},
+		{
+			name:     "getatt sequence",
+			template: "Value: !GetAtt [Bucket, Arn]",
+			want:     "Value: {Fn::GetAtt: [Bucket, Arn]}",
+		},
+		{
+			name:     "nested",
+			template: "Value: !Join ['', [!Ref Prefix, !GetAtt Bucket.Arn]]",
+			want:     "Value: {Fn::Join: ['', [{Ref: Prefix}, {Fn::GetAtt: [Bucket, Arn]}]]}",
+		},
+		{
+			name:     "scalar stays a string",
+			template: "Value: !Ref 123",
+			want:     "Value: {Ref: '123'}",
+		},
+		{
+			name:     "core tags are untouched",
+			template: "Value: !!str 123",
+			want:     "Value: '123'",
+		},
+		{
+			name:     "long form is untouched",
+			template: "Value: {Fn::Sub: '${Bucket}'}",
+			want:     "Value: {Fn::Sub: '${Bucket}'}",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, expandErr := ExpandShortIntrinsics([]byte(test.template))
+			if expandErr != nil {
+				t.Fatal(expandErr)
+			}
+
+			var got, want interface{}
+			if unmarshalErr := yaml.Unmarshal(expanded, &got); unmarshalErr != nil {
+				t.Fatal(unmarshalErr)
+			}
+			if unmarshalErr := yaml.Unmarshal([]byte(test.want), &want); unmarshalErr != nil {
+				t.Fatal(unmarshalErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v from:\n%s", want, got, expanded)
+			}
+		})
+	}
+}
+
+func TestExpandShortIntrinsicsInvalid(t *testing.T) {
+	if _, expandErr := ExpandShortIntrinsics([]byte("Value: [unclosed")); expandErr == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/token"
+	"cuelang.org/go/pkg/encoding/yaml"
+)
+
+// CloudFormation quotas checked by LintTemplate
+const (
+	maxTemplateBodySize = 51200
+	maxResources        = 500
+	maxParameters       = 200
+	maxOutputs          = 200
+	maxMappings         = 200
+	maxLogicalIDLength  = 255
+)
+
+var logicalIDRegexp = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+var subVariableRegexp = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+
+var pseudoParameters = map[string]bool{
+	"AWS::AccountId":        true,
+	"AWS::NotificationARNs": true,
+	"AWS::NoValue":          true,
+	"AWS::Partition":        true,
+	"AWS::Region":           true,
+	"AWS::StackId":          true,
+	"AWS::StackName":        true,
+	"AWS::URLSuffix":        true,
+}
+
+// LintSeverity tells whether a finding must be fixed before the template can be deployed
+type LintSeverity int
+
+const (
+	// LintWarning findings are likely mistakes that CloudFormation will accept
+	LintWarning LintSeverity = iota
+	// LintError findings will fail validation or deployment
+	LintError
+)
+
+// LintFinding is an issue found in a template along with its Cue source position
+type LintFinding struct {
+	Severity LintSeverity
+	Pos      token.Pos
+	Message  string
+}
+
+type linter struct {
+	parameters, resources map[string]cue.Value
+	usedParameters        map[string]bool
+	findings              []LintFinding
+}
+
+// LintTemplate checks the Template value of a stack offline for issues that ValidateTemplate, or worse a deployment,
+// would otherwise report: unresolved Ref, Fn::GetAtt and Fn::Sub targets, DependsOn pointing at missing resources,
+// unused parameters, invalid logical ids, and template size and count quotas
+func LintTemplate(template cue.Value) []LintFinding {
+	l := linter{
+		parameters:     getSection(template, "Parameters"),
+		resources:      getSection(template, "Resources"),
+		usedParameters: make(map[string]bool),
+	}
+
+	for _, section := range []string{"Parameters", "Resources", "Outputs", "Conditions", "Mappings"} {
+		for logicalID, value := range getSection(template, section) {
+			if !logicalIDRegexp.MatchString(logicalID) {
+				l.errorf(value.Pos(), "%s %s: logical ids must be alphanumeric", section, logicalID)
+			} else if len(logicalID) > maxLogicalIDLength {
+				l.errorf(value.Pos(), "%s %s: logical ids must be at most %d characters", section, logicalID, maxLogicalIDLength)
+			}
+		}
+	}
+
+	for _, limit := range []struct {
+		section string
+		max     int
+	}{{"Resources", maxResources}, {"Parameters", maxParameters}, {"Outputs", maxOutputs}, {"Mappings", maxMappings}} {
+		if count := len(getSection(template, limit.section)); count > limit.max {
+			l.errorf(template.LookupPath(cue.ParsePath(limit.section)).Pos(), "%d %s exceed the limit of %d", count, limit.section, limit.max)
+		}
+	}
+
+	if templateBody, templateBodyErr := yaml.Marshal(template); templateBodyErr == nil && len(templateBody) > maxTemplateBodySize {
+		l.errorf(template.Pos(), "template is %d bytes, which exceeds the TemplateBody limit of %d bytes", len(templateBody), maxTemplateBodySize)
+	}
+
+	for logicalID, resource := range l.resources {
+		dependsOn := resource.LookupPath(cue.ParsePath("DependsOn"))
+		for _, dependency := range stringOrList(dependsOn) {
+			if _, ok := l.resources[dependency.name]; !ok {
+				l.errorf(dependency.pos, "Resources %s: DependsOn %s is not a resource", logicalID, dependency.name)
+			}
+		}
+	}
+
+	for _, section := range []string{"Conditions", "Resources", "Outputs", "Rules"} {
+		sectionValue := template.LookupPath(cue.ParsePath(section))
+		if sectionValue.Exists() {
+			l.walk(sectionValue, section, nil)
+		}
+	}
+
+	for name, parameter := range l.parameters {
+		if !l.usedParameters[name] {
+			l.warnf(parameter.Pos(), "Parameters %s is never referenced", name)
+		}
+	}
+
+	return l.findings
+}
+
+// walk looks for intrinsic functions in value. subVariables are the variables declared by an enclosing Fn::Sub
+func (l *linter) walk(value cue.Value, path string, subVariables map[string]bool) {
+	switch value.IncompleteKind() {
+	case cue.StructKind:
+		fields, fieldsErr := value.Fields()
+		if fieldsErr != nil {
+			return
+		}
+		for fields.Next() {
+			label := fields.Label()
+			fieldValue := fields.Value()
+			switch label {
+			case "Ref":
+				if ref, refErr := fieldValue.String(); refErr == nil {
+					l.resolve(ref, fieldValue.Pos(), path, "Ref", subVariables)
+				}
+				continue
+			case "Fn::GetAtt":
+				l.getAtt(fieldValue, path)
+				continue
+			case "Fn::Sub":
+				l.sub(fieldValue, path)
+				continue
+			}
+			l.walk(fieldValue, path+"."+label, subVariables)
+		}
+
+	case cue.ListKind:
+		list, listErr := value.List()
+		if listErr != nil {
+			return
+		}
+		for i := 0; list.Next(); i++ {
+			l.walk(list.Value(), fmt.Sprintf("%s.%d", path, i), subVariables)
+		}
+	}
+}
+
+func (l *linter) getAtt(getAtt cue.Value, path string) {
+	var resource string
+	if getAttString, getAttErr := getAtt.String(); getAttErr == nil {
+		// the string form is Resource.Attribute
+		resource = strings.SplitN(getAttString, ".", 2)[0]
+	} else if list, listErr := getAtt.List(); listErr == nil && list.Next() {
+		var resourceErr error
+		resource, resourceErr = list.Value().String()
+		if resourceErr != nil {
+			return
+		}
+	} else {
+		return
+	}
+
+	if _, ok := l.resources[resource]; !ok {
+		l.errorf(getAtt.Pos(), "%s: Fn::GetAtt %s is not a resource", path, resource)
+	}
+}
+
+func (l *linter) sub(sub cue.Value, path string) {
+	subString, subErr := sub.String()
+	variables := make(map[string]bool)
+
+	if subErr != nil {
+		// the list form is [String, {Variable: Value}]
+		list, listErr := sub.List()
+		if listErr != nil || !list.Next() {
+			return
+		}
+		subString, subErr = list.Value().String()
+		if subErr != nil {
+			return
+		}
+		if list.Next() {
+			variablesValue := list.Value()
+			l.walk(variablesValue, path+".Fn::Sub", nil)
+			fields, fieldsErr := variablesValue.Fields()
+			for fieldsErr == nil && fields.Next() {
+				variables[fields.Label()] = true
+			}
+		}
+	}
+
+	for _, match := range subVariableRegexp.FindAllStringSubmatch(subString, -1) {
+		l.resolve(strings.SplitN(match[1], ".", 2)[0], sub.Pos(), path, "Fn::Sub", variables)
+	}
+}
+
+// resolve checks that name is a parameter, resource, pseudo parameter or Fn::Sub variable and marks parameters as used
+func (l *linter) resolve(name string, pos token.Pos, path, function string, subVariables map[string]bool) {
+	if _, ok := l.parameters[name]; ok {
+		l.usedParameters[name] = true
+		return
+	}
+	if _, ok := l.resources[name]; ok {
+		return
+	}
+	if pseudoParameters[name] || subVariables[name] {
+		return
+	}
+	l.errorf(pos, "%s: %s %s is not a parameter, resource or pseudo parameter", path, function, name)
+}
+
+func (l *linter) errorf(pos token.Pos, format string, args ...interface{}) {
+	l.findings = append(l.findings, LintFinding{Severity: LintError, Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(pos token.Pos, format string, args ...interface{}) {
+	l.findings = append(l.findings, LintFinding{Severity: LintWarning, Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// getSection returns the fields of a top level template section
+func getSection(template cue.Value, section string) map[string]cue.Value {
+	fields := make(map[string]cue.Value)
+	sectionFields, sectionErr := template.LookupPath(cue.ParsePath(section)).Fields()
+	if sectionErr != nil {
+		return fields
+	}
+	for sectionFields.Next() {
+		fields[sectionFields.Label()] = sectionFields.Value()
+	}
+	return fields
+}
+
+type positionedString struct {
+	name string
+	pos  token.Pos
+}
+
+// stringOrList returns the strings of a value that is either a string or a list of strings, like DependsOn
+func stringOrList(value cue.Value) []positionedString {
+	if str, strErr := value.String(); strErr == nil {
+		return []positionedString{{name: str, pos: value.Pos()}}
+	}
+	var strs []positionedString
+	list, listErr := value.List()
+	for listErr == nil && list.Next() {
+		if str, strErr := list.Value().String(); strErr == nil {
+			strs = append(strs, positionedString{name: str, pos: list.Value().Pos()})
+		}
+	}
+	return strs
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestLintTemplate(t *testing.T) {
+	var manyResources strings.Builder
+	for i := 0; i <= maxResources; i++ {
+		fmt.Fprintf(&manyResources, "Topic%d: Type: \"AWS::SNS::Topic\"\n", i)
+	}
+
+	tests := []struct {
+		name, template string
+		// want are the messages of the findings, in any order
+		want     []string
+		severity LintSeverity
+		// wantLine is the line of the first finding in the template, 0 to skip the check
+		wantLine int
+	}{
+		{
+			name: "clean template",
+			template: `
+Parameters: Name: Type: "String"
+Resources: {
+	Bucket: {
+		Type: "AWS::S3::Bucket"
+		Properties: BucketName: Ref: "Name"
+	}
+	Policy: {
+		Type:      "AWS::S3::BucketPolicy"
+		DependsOn: ["Bucket"]
+		Properties: {
+			Bucket: "Fn::GetAtt": ["Bucket", "Arn"]
+			PolicyDocument: Resource: "Fn::Sub": ["${Bucket.Arn}/${Path}-${AWS::Region}", {Path: "files"}]
+		}
+	}
+}
+Outputs: Arn: Value: "Fn::GetAtt": "Bucket.Arn"
+`,
+		},
+		{
+			name: "unresolved Ref",
+			template: `
+Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: BucketName: Ref: "Name"
+}
+`,
+			want:     []string{"Resources.Bucket.Properties.BucketName: Ref Name is not a parameter, resource or pseudo parameter"},
+			severity: LintError,
+			wantLine: 4,
+		},
+		{
+			name: "unresolved Fn::GetAtt",
+			template: `
+Resources: Bucket: Type: "AWS::S3::Bucket"
+Outputs: Arn: Value: "Fn::GetAtt": ["Queue", "Arn"]
+`,
+			want:     []string{"Outputs.Arn.Value: Fn::GetAtt Queue is not a resource"},
+			severity: LintError,
+			wantLine: 3,
+		},
+		{
+			name: "unresolved Fn::GetAtt string form",
+			template: `
+Resources: Bucket: Type: "AWS::S3::Bucket"
+Outputs: Arn: Value: "Fn::GetAtt": "Queue.Arn"
+`,
+			want:     []string{"Outputs.Arn.Value: Fn::GetAtt Queue is not a resource"},
+			severity: LintError,
+		},
+		{
+			name: "unresolved Fn::Sub variable",
+			template: `
+Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: BucketName: "Fn::Sub": "${Prefix}-${AWS::Region}-${!Literal}"
+}
+`,
+			want:     []string{"Resources.Bucket.Properties.BucketName: Fn::Sub Prefix is not a parameter, resource or pseudo parameter"},
+			severity: LintError,
+		},
+		{
+			name: "unresolved Ref in Fn::Sub variables",
+			template: `
+Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: BucketName: "Fn::Sub": ["${Prefix}", {Prefix: Ref: "Name"}]
+}
+`,
+			want:     []string{"Resources.Bucket.Properties.BucketName.Fn::Sub.Prefix: Ref Name is not a parameter, resource or pseudo parameter"},
+			severity: LintError,
+		},
+		{
+			name: "DependsOn a missing resource",
+			template: `
+Resources: Bucket: {
+	Type:      "AWS::S3::Bucket"
+	DependsOn: "Queue"
+}
+`,
+			want:     []string{"Resources Bucket: DependsOn Queue is not a resource"},
+			severity: LintError,
+			wantLine: 4,
+		},
+		{
+			name: "unused parameter",
+			template: `
+Parameters: Name: Type: "String"
+Resources: Bucket: Type: "AWS::S3::Bucket"
+`,
+			want:     []string{"Parameters Name is never referenced"},
+			severity: LintWarning,
+			wantLine: 2,
+		},
+		{
+			name: "invalid logical id",
+			template: `
+Resources: "my-bucket": Type: "AWS::S3::Bucket"
+`,
+			want:     []string{"Resources my-bucket: logical ids must be alphanumeric"},
+			severity: LintError,
+			wantLine: 2,
+		},
+		{
+			name:     "logical id too long",
+			template: fmt.Sprintf("Resources: %s: Type: \"AWS::S3::Bucket\"\n", strings.Repeat("B", maxLogicalIDLength+1)),
+			want:     []string{fmt.Sprintf("Resources %s: logical ids must be at most %d characters", strings.Repeat("B", maxLogicalIDLength+1), maxLogicalIDLength)},
+			severity: LintError,
+		},
+		{
+			name:     "too many resources",
+			template: "Resources: {\n" + manyResources.String() + "}\n",
+			want:     []string{fmt.Sprintf("%d Resources exceed the limit of %d", maxResources+1, maxResources)},
+			severity: LintError,
+		},
+		{
+			name: "template body too large",
+			template: fmt.Sprintf(`
+Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Metadata: Padding: %q
+}
+`, strings.Repeat("x", maxTemplateBodySize)),
+			want:     []string{"which exceeds the TemplateBody limit of 51200 bytes"},
+			severity: LintError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := cuecontext.New().CompileString(test.template, cue.Filename("stack.cue"))
+			if template.Err() != nil {
+				t.Fatal(template.Err())
+			}
+
+			findings := LintTemplate(template)
+			if len(findings) != len(test.want) {
+				t.Fatalf("expected %d findings, got %+v", len(test.want), findings)
+			}
+			for _, want := range test.want {
+				found := false
+				for _, finding := range findings {
+					if strings.Contains(finding.Message, want) {
+						found = true
+						if finding.Severity != test.severity {
+							t.Errorf("%q: expected severity %d, got %d", finding.Message, test.severity, finding.Severity)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("expected a finding %q, got %+v", want, findings)
+				}
+			}
+			if test.wantLine != 0 {
+				if pos := findings[0].Pos; pos.Filename() != "stack.cue" || pos.Line() != test.wantLine {
+					t.Errorf("expected the finding at stack.cue:%d, got %s", test.wantLine, pos)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue/build"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/joho/godotenv"
+	goYaml "gopkg.in/yaml.v2"
+)
+
+// override sources, as set in Stacks[stackname].Overrides[key].Source
+const (
+	OverrideFile           = "file"
+	OverrideSops           = "sops"
+	OverrideSSM            = "ssm"
+	OverrideSecretsManager = "secretsmanager"
+)
+
+// NoEchoMask is the value CloudFormation returns in place of the values of NoEcho parameters
+const NoEchoMask = "****"
+
+// OverrideSource loads the key values of a stack override
+type OverrideSource interface {
+	// Load returns the key values of the override
+	Load(ctx context.Context) (map[string]string, error)
+	// String describes the source without ever including a value
+	String() string
+}
+
+// NewOverrideSource returns the source of the override declared by key in Stacks[stackname].Overrides:
+// a yaml, json or dotenv file, the same encrypted with sops, a Systems Manager parameter or path, or a Secrets Manager
+// secret holding a json object. Parameters and secrets are read with the stack's profile and region by default
+func NewOverrideSource(key string, override Override, stack Stack, buildInstance *build.Instance) (OverrideSource, error) {
+	profile, region := stack.Profile, stack.Region
+	if override.Profile != "" {
+		profile = override.Profile
+	}
+	if override.Region != "" {
+		region = override.Region
+	}
+
+	source := override.SourceName()
+	switch source {
+	case OverrideFile:
+		return fileOverride{path: ResolveOverridePath(key, buildInstance)}, nil
+	case OverrideSops:
+		sopsProfile := override.SopsProfile
+		if sopsProfile == "" {
+			sopsProfile = profile
+		}
+		return sopsOverride{path: ResolveOverridePath(key, buildInstance), profile: sopsProfile}, nil
+	case OverrideSSM:
+		return ssmOverride{name: key, profile: profile, region: region, reference: override.Reference}, nil
+	case OverrideSecretsManager:
+		if override.Reference && len(override.Map) == 0 {
+			return nil, fmt.Errorf("override %s: Reference requires Map to name the keys of the secret", key)
+		}
+		return secretsManagerOverride{secretID: key, keys: override.Map, profile: profile, region: region, reference: override.Reference}, nil
+	}
+	return nil, fmt.Errorf("override %s: unknown Source %s", key, source)
+}
+
+// SourceName returns Source, defaulting to sops when SopsProfile is set and to file otherwise
+func (o Override) SourceName() string {
+	if o.Source != "" {
+		return o.Source
+	}
+	if o.SopsProfile != "" {
+		return OverrideSops
+	}
+	return OverrideFile
+}
+
+type fileOverride struct {
+	path string
+}
+
+func (o fileOverride) Load(ctx context.Context) (map[string]string, error) {
+	fileBytes, readErr := ioutil.ReadFile(o.path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	return unmarshalOverride(o.path, fileBytes)
+}
+
+func (o fileOverride) String() string {
+	return o.path
+}
+
+type sopsOverride struct {
+	path, profile string
+}
+
+func (o sopsOverride) Load(ctx context.Context) (map[string]string, error) {
+	// DecryptSecrets always returns yaml
+	yamlBytes, decryptErr := DecryptSecrets(o.path, o.profile)
+	if decryptErr != nil {
+		return nil, decryptErr
+	}
+	return unmarshalOverride("", yamlBytes)
+}
+
+func (o sopsOverride) String() string {
+	return o.path + " (sops)"
+}
+
+// unmarshalOverride parses dotenv files by extension, and anything else as yaml which json is a subset of
+func unmarshalOverride(path string, overrideBytes []byte) (map[string]string, error) {
+	if filepath.Ext(path) == ".env" {
+		return godotenv.Unmarshal(string(overrideBytes))
+	}
+	var override map[string]string
+	unmarshalErr := goYaml.Unmarshal(overrideBytes, &override)
+	return override, unmarshalErr
+}
+
+// ssmAPI is the part of the Systems Manager client read by ssmOverride
+type ssmAPI interface {
+	ssm.GetParametersByPathAPIClient
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// ssmOverride reads a single parameter, keyed by the last segment of its name, or the parameters directly under a
+// path ending with /, keyed by their name relative to the path.
+// As a reference, the values are the parameter names, for template parameters of type AWS::SSM::Parameter::Value<String>
+type ssmOverride struct {
+	name, profile, region string
+	reference             bool
+	// client defaults to a client for profile and region
+	client ssmAPI
+}
+
+func (o ssmOverride) Load(ctx context.Context) (map[string]string, error) {
+	override := make(map[string]string)
+	client := o.client
+	if client == nil {
+		client = GetSSMClient(o.profile, o.region)
+	}
+
+	if !strings.HasSuffix(o.name, "/") {
+		key := o.name[strings.LastIndex(o.name, "/")+1:]
+		if o.reference {
+			override[key] = o.name
+			return override, nil
+		}
+		getParameterOutput, getParameterErr := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(o.name), WithDecryption: true})
+		if getParameterErr != nil {
+			return nil, getParameterErr
+		}
+		override[key] = aws.ToString(getParameterOutput.Parameter.Value)
+		return override, nil
+	}
+
+	paginator := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{Path: aws.String(o.name), WithDecryption: !o.reference})
+	for paginator.HasMorePages() {
+		page, pageErr := paginator.NextPage(ctx)
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		for _, parameter := range page.Parameters {
+			name := aws.ToString(parameter.Name)
+			if o.reference {
+				override[strings.TrimPrefix(name, o.name)] = name
+			} else {
+				override[strings.TrimPrefix(name, o.name)] = aws.ToString(parameter.Value)
+			}
+		}
+	}
+	return override, nil
+}
+
+func (o ssmOverride) String() string {
+	if o.reference {
+		return "ssm:" + o.name + " (reference)"
+	}
+	return "ssm:" + o.name
+}
+
+// secretsManagerAPI is the part of the Secrets Manager client read by secretsManagerOverride
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// secretsManagerOverride reads the keys of a secret whose SecretString is a json object.
+// As a reference, the secret is not read and values are CloudFormation dynamic references to the keys named by Map
+type secretsManagerOverride struct {
+	secretID, profile, region string
+	keys                      map[string]string
+	reference                 bool
+	// client defaults to a client for profile and region
+	client secretsManagerAPI
+}
+
+func (o secretsManagerOverride) Load(ctx context.Context) (map[string]string, error) {
+	if o.reference {
+		override := make(map[string]string)
+		for key := range o.keys {
+			override[key] = fmt.Sprintf("{{resolve:secretsmanager:%s:SecretString:%s}}", o.secretID, key)
+		}
+		return override, nil
+	}
+
+	client := o.client
+	if client == nil {
+		client = GetSecretsManagerClient(o.profile, o.region)
+	}
+	getSecretValueOutput, getSecretValueErr := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(o.secretID)})
+	if getSecretValueErr != nil {
+		return nil, getSecretValueErr
+	}
+
+	var override map[string]string
+	unmarshalErr := json.Unmarshal([]byte(aws.ToString(getSecretValueOutput.SecretString)), &override)
+	if unmarshalErr != nil {
+		// never include the secret in the error
+		return nil, fmt.Errorf("SecretString of %s is not a json object of strings", o.secretID)
+	}
+	return override, nil
+}
+
+func (o secretsManagerOverride) String() string {
+	if o.reference {
+		return "secretsmanager:" + o.secretID + " (reference)"
+	}
+	return "secretsmanager:" + o.secretID
+}
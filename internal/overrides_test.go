@@ -0,0 +1,397 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/build"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestOverrideSourceName(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		want     string
+	}{
+		{name: "file by default", override: Override{}, want: OverrideFile},
+		{name: "sops with SopsProfile", override: Override{SopsProfile: "kms"}, want: OverrideSops},
+		{name: "Source wins over SopsProfile", override: Override{Source: OverrideSSM, SopsProfile: "kms"}, want: OverrideSSM},
+		{name: "Source", override: Override{Source: OverrideSecretsManager}, want: OverrideSecretsManager},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.override.SourceName(); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewOverrideSource(t *testing.T) {
+	stack := Stack{Name: "app-qa", Profile: "qa", Region: "us-east-1"}
+	buildInstance := &build.Instance{Root: "/stax", Dir: "/stax/app"}
+
+	tests := []struct {
+		name, key string
+		override  Override
+		want      OverrideSource
+		wantErr   string
+	}{
+		{
+			name:     "file relative to the cue path",
+			key:      "${STX::CuePath}/overrides.yml",
+			override: Override{},
+			want:     fileOverride{path: "/stax/app/overrides.yml"},
+		},
+		{
+			name:     "sops with the stack's profile",
+			key:      "secrets.env",
+			override: Override{Source: OverrideSops},
+			want:     sopsOverride{path: "/stax/secrets.env", profile: "qa"},
+		},
+		{
+			name:     "sops with SopsProfile",
+			key:      "secrets.env",
+			override: Override{SopsProfile: "kms"},
+			want:     sopsOverride{path: "/stax/secrets.env", profile: "kms"},
+		},
+		{
+			name:     "ssm with the override's profile and region",
+			key:      "/app/qa/",
+			override: Override{Source: OverrideSSM, Profile: "shared", Region: "us-west-2", Reference: true},
+			want:     ssmOverride{name: "/app/qa/", profile: "shared", region: "us-west-2", reference: true},
+		},
+		{
+			name:     "secretsmanager reference",
+			key:      "app/qa",
+			override: Override{Source: OverrideSecretsManager, Reference: true, Map: map[string]string{"DbPassword": "password"}},
+			want:     secretsManagerOverride{secretID: "app/qa", keys: map[string]string{"DbPassword": "password"}, profile: "qa", region: "us-east-1", reference: true},
+		},
+		{
+			name:     "secretsmanager reference without Map",
+			key:      "app/qa",
+			override: Override{Source: OverrideSecretsManager, Reference: true},
+			wantErr:  "Reference requires Map",
+		},
+		{
+			name:     "unknown source",
+			key:      "app/qa",
+			override: Override{Source: "vault"},
+			wantErr:  "unknown Source vault",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, sourceErr := NewOverrideSource(test.key, test.override, stack, buildInstance)
+			if test.wantErr != "" {
+				if sourceErr == nil || !strings.Contains(sourceErr.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, sourceErr)
+				}
+				return
+			}
+			if sourceErr != nil {
+				t.Fatal(sourceErr)
+			}
+			if !reflect.DeepEqual(source, test.want) {
+				t.Errorf("expected %#v, got %#v", test.want, source)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOverride(t *testing.T) {
+	tests := []struct {
+		name, path, content string
+		want                map[string]string
+		wantErr             bool
+	}{
+		{
+			name: "dotenv",
+			path: "overrides.env",
+			content: `# comment
+DbName=app
+export DbUser=admin
+DbPassword="p4ss word"
+`,
+			want: map[string]string{"DbName": "app", "DbUser": "admin", "DbPassword": "p4ss word"},
+		},
+		{
+			name: "yaml",
+			path: "overrides.yml",
+			content: `DbName: app
+DbPort: "5432"
+`,
+			want: map[string]string{"DbName": "app", "DbPort": "5432"},
+		},
+		{
+			name:    "yaml scalars are read as strings",
+			path:    "overrides.yaml",
+			content: "DbPort: 5432\nMultiAZ: true\n",
+			want:    map[string]string{"DbPort": "5432", "MultiAZ": "true"},
+		},
+		{
+			name:    "json",
+			path:    "overrides.json",
+			content: `{"DbName": "app", "DbPort": "5432"}`,
+			want:    map[string]string{"DbName": "app", "DbPort": "5432"},
+		},
+		{
+			name:    "sops output without a path is yaml",
+			content: "DbPassword: secret\n",
+			want:    map[string]string{"DbPassword": "secret"},
+		},
+		{
+			name:    "yaml that is not a map",
+			path:    "overrides.yml",
+			content: "- DbName\n",
+			wantErr: true,
+		},
+		{
+			name:    "dotenv is only read from .env files",
+			path:    "overrides.txt",
+			content: "DbName=app\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, unmarshalErr := unmarshalOverride(test.path, []byte(test.content))
+			if test.wantErr {
+				if unmarshalErr == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if unmarshalErr != nil {
+				t.Fatal(unmarshalErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFileOverrideLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.env")
+	if writeErr := os.WriteFile(path, []byte("DbName=app\n"), 0644); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	got, loadErr := fileOverride{path: path}.Load(context.Background())
+	if loadErr != nil {
+		t.Fatal(loadErr)
+	}
+	if want := map[string]string{"DbName": "app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, loadErr := (fileOverride{path: path + ".missing"}).Load(context.Background()); loadErr == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// ssmStub serves parameters from memory, paginating GetParametersByPath one parameter per page
+type ssmStub struct {
+	parameters map[string]string
+	calls      []string
+}
+
+func (s *ssmStub) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	s.calls = append(s.calls, "GetParameter")
+	value, ok := s.parameters[aws.ToString(params.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmTypes.Parameter{Name: params.Name, Value: aws.String(value)}}, nil
+}
+
+func (s *ssmStub) GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	s.calls = append(s.calls, "GetParametersByPath")
+	var names []string
+	for name := range s.parameters {
+		if strings.HasPrefix(name, aws.ToString(params.Path)) && !strings.Contains(strings.TrimPrefix(name, aws.ToString(params.Path)), "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start := 0
+	if params.NextToken != nil {
+		for i, name := range names {
+			if name == aws.ToString(params.NextToken) {
+				start = i
+			}
+		}
+	}
+	output := &ssm.GetParametersByPathOutput{}
+	if start < len(names) {
+		value := s.parameters[names[start]]
+		if !params.WithDecryption {
+			value = "encrypted"
+		}
+		output.Parameters = []ssmTypes.Parameter{{Name: aws.String(names[start]), Value: aws.String(value)}}
+	}
+	if start+1 < len(names) {
+		output.NextToken = aws.String(names[start+1])
+	}
+	return output, nil
+}
+
+func TestSSMOverrideLoad(t *testing.T) {
+	parameters := map[string]string{
+		"/app/qa/DbName":        "app",
+		"/app/qa/DbPassword":    "s3cr3t",
+		"/app/qa/nested/Ignore": "nested",
+	}
+
+	tests := []struct {
+		name      string
+		override  ssmOverride
+		want      map[string]string
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "parameter",
+			override:  ssmOverride{name: "/app/qa/DbPassword"},
+			want:      map[string]string{"DbPassword": "s3cr3t"},
+			wantCalls: []string{"GetParameter"},
+		},
+		{
+			name:     "parameter reference is not read",
+			override: ssmOverride{name: "/app/qa/DbPassword", reference: true},
+			want:     map[string]string{"DbPassword": "/app/qa/DbPassword"},
+		},
+		{
+			name:      "path",
+			override:  ssmOverride{name: "/app/qa/"},
+			want:      map[string]string{"DbName": "app", "DbPassword": "s3cr3t"},
+			wantCalls: []string{"GetParametersByPath", "GetParametersByPath"},
+		},
+		{
+			name:      "path reference",
+			override:  ssmOverride{name: "/app/qa/", reference: true},
+			want:      map[string]string{"DbName": "/app/qa/DbName", "DbPassword": "/app/qa/DbPassword"},
+			wantCalls: []string{"GetParametersByPath", "GetParametersByPath"},
+		},
+		{
+			name:      "missing parameter",
+			override:  ssmOverride{name: "/app/qa/Missing"},
+			wantCalls: []string{"GetParameter"},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &ssmStub{parameters: parameters}
+			test.override.client = stub
+
+			got, loadErr := test.override.Load(context.Background())
+			if test.wantErr {
+				if loadErr == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+			} else if loadErr != nil {
+				t.Fatal(loadErr)
+			} else if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			if !reflect.DeepEqual(stub.calls, test.wantCalls) {
+				t.Errorf("expected calls %v, got %v", test.wantCalls, stub.calls)
+			}
+		})
+	}
+}
+
+// secretsManagerStub serves SecretString from memory
+type secretsManagerStub struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (s *secretsManagerStub) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	s.calls++
+	secret, ok := s.secrets[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+func TestSecretsManagerOverrideLoad(t *testing.T) {
+	secrets := map[string]string{
+		"app/qa":    `{"DbPassword": "s3cr3t", "DbUser": "admin"}`,
+		"app/plain": "s3cr3t",
+	}
+
+	tests := []struct {
+		name      string
+		override  secretsManagerOverride
+		want      map[string]string
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "json object",
+			override:  secretsManagerOverride{secretID: "app/qa"},
+			want:      map[string]string{"DbPassword": "s3cr3t", "DbUser": "admin"},
+			wantCalls: 1,
+		},
+		{
+			name:     "reference is not read",
+			override: secretsManagerOverride{secretID: "app/qa", keys: map[string]string{"DbPassword": "password"}, reference: true},
+			want:     map[string]string{"DbPassword": "{{resolve:secretsmanager:app/qa:SecretString:DbPassword}}"},
+		},
+		{
+			name:      "not a json object",
+			override:  secretsManagerOverride{secretID: "app/plain"},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "missing secret",
+			override:  secretsManagerOverride{secretID: "app/missing"},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &secretsManagerStub{secrets: secrets}
+			test.override.client = stub
+
+			got, loadErr := test.override.Load(context.Background())
+			if test.wantErr {
+				if loadErr == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				if strings.Contains(loadErr.Error(), "s3cr3t") {
+					t.Errorf("secret leaked in %v", loadErr)
+				}
+			} else if loadErr != nil {
+				t.Fatal(loadErr)
+			} else if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			if stub.calls != test.wantCalls {
+				t.Errorf("expected %d calls, got %d", test.wantCalls, stub.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
+	cueErrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/token"
+)
+
+// policyPackage is the cue package policy files must declare
+const policyPackage = "policy"
+
+// policy severities
+const (
+	PolicyError   = "error"
+	PolicyWarning = "warning"
+)
+
+// Policy is a constraint unified with every stack. A stack violates the policy when the unification fails
+// or leaves a field incomplete. Policies are declared in Cue as
+//
+//	Policies: "s3-encryption": {
+//		Severity: "error" // or "warning"
+//		Message:  "every S3 bucket must have encryption"
+//		Stack: Template: Resources: [_]: {
+//			Type: string
+//			if Type == "AWS::S3::Bucket" {
+//				Properties: BucketEncryption: _
+//			}
+//		}
+//	}
+type Policy struct {
+	Name, Severity, Message string
+	Stack                   cue.Value
+}
+
+// PolicyViolation is a stack failing a policy, Err holds the Cue errors of the unification
+type PolicyViolation struct {
+	Policy     Policy
+	Err        error
+	stackValue cue.Value
+}
+
+// PoliciesPath returns Policies.Path resolved against the Cue root, or an empty string when no path is configured
+func PoliciesPath(config *Config) string {
+	if config.Policies.Path == "" || filepath.IsAbs(config.Policies.Path) {
+		return config.Policies.Path
+	}
+	return filepath.Join(config.CueRoot, config.Policies.Path)
+}
+
+// LoadPolicies builds the policy packages found under Policies.Path. No policies are returned when the path does not exist
+func LoadPolicies(config *Config) ([]Policy, error) {
+	policyPath := PoliciesPath(config)
+	if policyPath == "" {
+		return nil, nil
+	}
+	if _, statErr := os.Stat(policyPath); os.IsNotExist(statErr) {
+		return nil, nil
+	}
+
+	buildInstances := GetBuildInstancesIn(policyPath, []string{"./..."}, policyPackage)
+
+	var policies []Policy
+	names := make(map[string]bool)
+	for _, buildInstance := range buildInstances {
+		if buildInstance.Err != nil {
+			return nil, buildInstance.Err
+		}
+		cueInstance := cue.Build([]*build.Instance{buildInstance})[0]
+		if cueInstance.Err != nil {
+			return nil, cueInstance.Err
+		}
+
+		policiesValue := cueInstance.Value().LookupPath(cue.ParsePath("Policies"))
+		if !policiesValue.Exists() {
+			continue
+		}
+		fields, fieldsErr := policiesValue.Fields()
+		if fieldsErr != nil {
+			return nil, fieldsErr
+		}
+		for fields.Next() {
+			policy, policyErr := newPolicy(fields.Label(), fields.Value())
+			if policyErr != nil {
+				return nil, policyErr
+			}
+			if names[policy.Name] {
+				return nil, fmt.Errorf("policy %s is declared in more than one package", policy.Name)
+			}
+			names[policy.Name] = true
+			policies = append(policies, policy)
+		}
+	}
+
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+func newPolicy(name string, value cue.Value) (Policy, error) {
+	policy := Policy{Name: name, Severity: PolicyError, Message: name}
+
+	if severityValue := value.LookupPath(cue.ParsePath("Severity")); severityValue.Exists() {
+		severity, severityErr := severityValue.String()
+		if severityErr != nil {
+			return policy, severityErr
+		}
+		if severity != PolicyError && severity != PolicyWarning {
+			return policy, fmt.Errorf("policy %s: Severity must be %q or %q, got %q", name, PolicyError, PolicyWarning, severity)
+		}
+		policy.Severity = severity
+	}
+
+	if messageValue := value.LookupPath(cue.ParsePath("Message")); messageValue.Exists() {
+		message, messageErr := messageValue.String()
+		if messageErr != nil {
+			return policy, messageErr
+		}
+		policy.Message = message
+	}
+
+	policy.Stack = value.LookupPath(cue.ParsePath("Stack"))
+	if !policy.Stack.Exists() {
+		return policy, fmt.Errorf("policy %s: Stack is undefined", name)
+	}
+	return policy, nil
+}
+
+// CheckPolicies unifies each policy with stackValue and returns the policies the stack violates
+func CheckPolicies(policies []Policy, stackValue cue.Value) []PolicyViolation {
+	stackData := openStack(stackValue)
+	var violations []PolicyViolation
+	for _, policy := range policies {
+		validateErr := policy.Stack.Unify(stackData).Validate(cue.Concrete(true))
+		if validateErr != nil {
+			violations = append(violations, PolicyViolation{Policy: policy, Err: validateErr, stackValue: stackValue})
+		}
+	}
+	return violations
+}
+
+// openStack rebuilds the data of stackValue without the closedness of core.#StackSettings, so a field required by a
+// policy is reported as missing from the policy rather than as not allowed in the stack
+func openStack(stackValue cue.Value) cue.Value {
+	expr, ok := stackValue.Syntax(cue.Final(), cue.Concrete(true)).(ast.Expr)
+	if !ok {
+		return stackValue
+	}
+	return stackValue.Context().BuildExpr(expr)
+}
+
+// Findings returns a lint finding for every Cue error of the violation, positioned where the stack conflicts with the policy
+func (v PolicyViolation) Findings() []LintFinding {
+	severity := LintError
+	if v.Policy.Severity == PolicyWarning {
+		severity = LintWarning
+	}
+
+	var findings []LintFinding
+	for _, cueErr := range cueErrors.Errors(v.Err) {
+		// errors are reported at the path of the policy, make them relative to the stack instead
+		labels := cueErr.Path()
+		if len(labels) > 2 && labels[0] == "Policies" && labels[2] == "Stack" {
+			labels = labels[3:]
+		}
+		selectors := make([]cue.Selector, len(labels))
+		for i, label := range labels {
+			if index, indexErr := strconv.Atoi(label); indexErr == nil {
+				selectors[i] = cue.Index(index)
+			} else if unquoted, unquoteErr := literal.Unquote(label); unquoteErr == nil {
+				selectors[i] = cue.Str(unquoted)
+			} else {
+				selectors[i] = cue.Str(label)
+			}
+		}
+
+		var pos token.Pos
+		if positions := cueErrors.Positions(cueErr); len(positions) > 0 {
+			pos = positions[0]
+		}
+		// incomplete values carry no position, use the closest existing parent in the stack
+		for i := len(selectors); !pos.IsValid() && i >= 0; i-- {
+			if value := v.stackValue.LookupPath(cue.MakePath(selectors[:i]...)); value.Exists() {
+				pos = value.Pos()
+			}
+		}
+
+		format, args := cueErr.Msg()
+		findings = append(findings, LintFinding{
+			Severity: severity,
+			Pos:      pos,
+			Message:  fmt.Sprintf("policy %s: %s (%s: %s)", v.Policy.Name, v.Policy.Message, cue.MakePath(selectors...), fmt.Sprintf(format, args...)),
+		})
+	}
+	return findings
+}
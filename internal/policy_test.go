@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+const testPolicies = `
+Policies: "s3-encryption": {
+	Message: "every S3 bucket must have encryption"
+	Stack: Template: Resources: [_]: {
+		Type: string
+		if Type == "AWS::S3::Bucket" {
+			Properties: BucketEncryption: _
+		}
+	}
+}
+Policies: "s3-versioning": {
+	Severity: "warning"
+	Message:  "S3 buckets should be versioned"
+	Stack: Template: Resources: [_]: {
+		Type: string
+		if Type == "AWS::S3::Bucket" {
+			Properties: VersioningConfiguration: Status: "Enabled"
+		}
+	}
+}
+`
+
+func TestCheckPolicies(t *testing.T) {
+	tests := []struct {
+		name, stack string
+		// want maps the violated policies to the messages of their findings
+		want map[string]string
+		// wantSeverity maps the violated policies to the severity of their findings
+		wantSeverity map[string]LintSeverity
+	}{
+		{
+			name: "compliant stack",
+			stack: `Stack: Template: Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: {
+		BucketEncryption: ServerSideEncryptionConfiguration: [{ServerSideEncryptionByDefault: SSEAlgorithm: "AES256"}]
+		VersioningConfiguration: Status: "Enabled"
+	}
+}`,
+		},
+		{
+			name: "error violation",
+			stack: `Stack: Template: Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: VersioningConfiguration: Status: "Enabled"
+}`,
+			want:         map[string]string{"s3-encryption": "policy s3-encryption: every S3 bucket must have encryption (Template.Resources.Bucket.Properties.BucketEncryption: incomplete value _)"},
+			wantSeverity: map[string]LintSeverity{"s3-encryption": LintError},
+		},
+		{
+			name: "warning violation",
+			stack: `Stack: Template: Resources: Bucket: {
+	Type: "AWS::S3::Bucket"
+	Properties: {
+		BucketEncryption: ServerSideEncryptionConfiguration: [{ServerSideEncryptionByDefault: SSEAlgorithm: "AES256"}]
+		VersioningConfiguration: Status: "Suspended"
+	}
+}`,
+			want:         map[string]string{"s3-versioning": `policy s3-versioning: S3 buckets should be versioned (Template.Resources.Bucket.Properties.VersioningConfiguration.Status: conflicting values "Enabled" and "Suspended")`},
+			wantSeverity: map[string]LintSeverity{"s3-versioning": LintWarning},
+		},
+		{
+			name: "closed stack is reopened",
+			stack: `
+#Stack: Template: Resources: [string]: {
+	Type: string
+	Properties?: VersioningConfiguration?: Status: string
+}
+Stack: #Stack & {
+	Template: Resources: Bucket: {
+		Type: "AWS::S3::Bucket"
+		Properties: VersioningConfiguration: Status: "Enabled"
+	}
+}`,
+			want:         map[string]string{"s3-encryption": "policy s3-encryption: every S3 bucket must have encryption (Template.Resources.Bucket.Properties.BucketEncryption: incomplete value _)"},
+			wantSeverity: map[string]LintSeverity{"s3-encryption": LintError},
+		},
+		{
+			name: "other resource types are ignored",
+			stack: `Stack: Template: Resources: Topic: {
+	Type: "AWS::SNS::Topic"
+}`,
+		},
+	}
+
+	policies := testPoliciesFrom(t, testPolicies)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stackValue := compileStack(t, test.stack)
+
+			violations := CheckPolicies(policies, stackValue)
+			if len(violations) != len(test.want) {
+				t.Fatalf("expected %d violations, got %+v", len(test.want), violations)
+			}
+			for _, violation := range violations {
+				want, ok := test.want[violation.Policy.Name]
+				if !ok {
+					t.Errorf("unexpected violation of %s: %v", violation.Policy.Name, violation.Err)
+					continue
+				}
+				findings := violation.Findings()
+				if len(findings) != 1 {
+					t.Fatalf("expected 1 finding, got %+v", findings)
+				}
+				if findings[0].Message != want {
+					t.Errorf("expected %q, got %q", want, findings[0].Message)
+				}
+				if findings[0].Severity != test.wantSeverity[violation.Policy.Name] {
+					t.Errorf("expected severity %d, got %d", test.wantSeverity[violation.Policy.Name], findings[0].Severity)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyViolationFindingsPosition(t *testing.T) {
+	policies := testPoliciesFrom(t, testPolicies)
+	stackValue := compileStack(t, `Stack: Template: Resources: {
+	Bucket: {
+		Type: "AWS::S3::Bucket"
+		Properties: VersioningConfiguration: Status: "Suspended"
+	}
+}`)
+
+	positions := make(map[string]string)
+	for _, violation := range CheckPolicies(policies, stackValue) {
+		for _, finding := range violation.Findings() {
+			positions[violation.Policy.Name] = finding.Pos.String()
+		}
+	}
+
+	// a missing field is reported at its closest parent in the stack
+	if got := positions["s3-encryption"]; got != "stack.cue:4:3" {
+		t.Errorf("expected the missing field at the stack's Properties, got %s", got)
+	}
+	// a conflict carries the position Cue reports first, the policy's constraint
+	if got := positions["s3-versioning"]; got != "policy.cue:14:35" {
+		t.Errorf("expected the conflict at the s3-versioning policy, got %s", got)
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name, policy, wantErr string
+		wantSeverity          string
+	}{
+		{name: "error by default", policy: `Stack: Template: _`, wantSeverity: PolicyError},
+		{name: "warning", policy: `Severity: "warning", Stack: Template: _`, wantSeverity: PolicyWarning},
+		{name: "invalid severity", policy: `Severity: "info", Stack: Template: _`, wantErr: `Severity must be "error" or "warning"`},
+		{name: "missing stack", policy: `Message: "m"`, wantErr: "Stack is undefined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, policyErr := newPolicy("p", cuecontext.New().CompileString(test.policy))
+			if test.wantErr != "" {
+				if policyErr == nil || !strings.Contains(policyErr.Error(), test.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", test.wantErr, policyErr)
+				}
+				return
+			}
+			if policyErr != nil {
+				t.Fatal(policyErr)
+			}
+			if policy.Severity != test.wantSeverity {
+				t.Errorf("expected severity %s, got %s", test.wantSeverity, policy.Severity)
+			}
+		})
+	}
+}
+
+// testPoliciesFrom builds the Policies declared in src like LoadPolicies does for a policy package
+func testPoliciesFrom(t *testing.T, src string) []Policy {
+	t.Helper()
+	policiesValue := cuecontext.New().CompileString(src, cue.Filename("policy.cue")).LookupPath(cue.ParsePath("Policies"))
+	fields, fieldsErr := policiesValue.Fields()
+	if fieldsErr != nil {
+		t.Fatal(fieldsErr)
+	}
+	var policies []Policy
+	for fields.Next() {
+		policy, policyErr := newPolicy(fields.Label(), fields.Value())
+		if policyErr != nil {
+			t.Fatal(policyErr)
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// compileStack returns the Stack field of src
+func compileStack(t *testing.T, src string) cue.Value {
+	t.Helper()
+	value := cuecontext.New().CompileString(src, cue.Filename("stack.cue"))
+	if value.Err() != nil {
+		t.Fatal(value.Err())
+	}
+	return value.LookupPath(cue.ParsePath("Stack"))
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+
+	"cuelang.org/go/cue"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// ResourceToImport represents the decoded value of Stacks[stackname].ResourcesToImport[logicalID]
+type ResourceToImport struct {
+	Identifier map[string]string
+}
+
+// GetResourcesToImport builds the ResourcesToImport of an IMPORT change set from the stack.
+// each resource must be declared in the template with DeletionPolicy: Retain as CloudFormation requires
+func GetResourcesToImport(stack Stack, stackValue cue.Value) ([]types.ResourceToImport, error) {
+	if len(stack.ResourcesToImport) < 1 {
+		return nil, fmt.Errorf("%s has no ResourcesToImport defined", stack.Name)
+	}
+
+	// sort the logical ids so change sets are created in a predictable order
+	logicalIDs := make([]string, 0, len(stack.ResourcesToImport))
+	for logicalID := range stack.ResourcesToImport {
+		logicalIDs = append(logicalIDs, logicalID)
+	}
+	sort.Strings(logicalIDs)
+
+	var resourcesToImport []types.ResourceToImport
+	for _, logicalID := range logicalIDs {
+		resource := stackValue.LookupPath(cue.MakePath(cue.Str("Template"), cue.Str("Resources"), cue.Str(logicalID)))
+		if !resource.Exists() {
+			return nil, fmt.Errorf("%s: resource to import %s is not defined in Template.Resources", stack.Name, logicalID)
+		}
+
+		resourceType, resourceTypeErr := resource.LookupPath(cue.ParsePath("Type")).String()
+		if resourceTypeErr != nil {
+			return nil, fmt.Errorf("%s: resource to import %s has no Type: %s", stack.Name, logicalID, resourceTypeErr)
+		}
+
+		deletionPolicy, _ := resource.LookupPath(cue.ParsePath("DeletionPolicy")).String()
+		if deletionPolicy != "Retain" {
+			return nil, fmt.Errorf("%s: resource to import %s must set DeletionPolicy: \"Retain\"", stack.Name, logicalID)
+		}
+
+		identifier := stack.ResourcesToImport[logicalID].Identifier
+		if len(identifier) < 1 {
+			return nil, fmt.Errorf("%s: resource to import %s has no Identifier", stack.Name, logicalID)
+		}
+
+		resourcesToImport = append(resourcesToImport, types.ResourceToImport{
+			LogicalResourceId:  aws.String(logicalID),
+			ResourceType:       aws.String(resourceType),
+			ResourceIdentifier: identifier,
+		})
+	}
+
+	return resourcesToImport, nil
+}
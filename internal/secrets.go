@@ -1,31 +1,58 @@
 package internal
 
 import (
-	"context"
-	"log"
-	"os"
+	"fmt"
+	"io/ioutil"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"go.mozilla.org/sops/v3/decrypt"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/kms"
 )
 
-// DecryptSecrets uses sops to decrypt the file with credentials from the given profile
+// DecryptSecrets uses sops to decrypt the yaml, json or dotenv file with credentials from the given profile,
+// and returns its cleartext as yaml whatever the format of the file
 func DecryptSecrets(file, profile string) ([]byte, error) {
+	encrypted, readErr := ioutil.ReadFile(file)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	store := common.StoreForFormat(formats.FormatForPath(file))
+	tree, loadErr := store.LoadEncryptedFile(encrypted)
+	if loadErr != nil {
+		return nil, loadErr
+	}
 
-	cfg, cfgErr := config.LoadDefaultConfig(context.TODO(), config.WithSharedConfigProfile(profile))
+	// KMS keys use the profile rather than process wide AWS_* environment variables
+	for _, keyGroup := range tree.Metadata.KeyGroups {
+		for _, key := range keyGroup {
+			if kmsKey, ok := key.(*kms.MasterKey); ok {
+				kmsKey.AwsProfile = profile
+			}
+		}
+	}
 
-	if cfgErr != nil {
-		log.Fatal(cfgErr)
+	dataKey, dataKeyErr := tree.Metadata.GetDataKey()
+	if dataKeyErr != nil {
+		return nil, dataKeyErr
 	}
 
-	creds, credsErr := cfg.Credentials.Retrieve(context.TODO())
-	if credsErr != nil {
-		log.Fatal(credsErr)
+	cipher := aes.NewCipher()
+	mac, decryptErr := tree.Decrypt(dataKey, cipher)
+	if decryptErr != nil {
+		return nil, decryptErr
+	}
+
+	// the mac of the cleartext must match the one stored in the file
+	originalMac, macErr := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if macErr != nil {
+		return nil, macErr
+	}
+	if originalMac != mac {
+		return nil, fmt.Errorf("failed to verify the integrity of %s", file)
 	}
 
-	// set ENV vars (primarily for sops decrypt)
-	os.Setenv("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
-	os.Setenv("AWS_SESSION_TOKEN", creds.SessionToken)
-	return decrypt.File(file, "yaml")
+	return common.StoreForFormat(formats.Yaml).EmitPlainFile(tree.Branches)
 }
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/token"
+)
+
+// StackDefault is an entry of the config StackDefaults that applies to a stack
+type StackDefault struct {
+	// Source locates the entry in StackDefaults, eg: Environments.prod
+	Source string
+	Value  cue.Value
+	// Fields are the fields of Value the stack did not set, and which the default supplied
+	Fields []DefaultedField
+}
+
+// DefaultedField is a field of a stack supplied by a StackDefault
+type DefaultedField struct {
+	Path, Source string
+	Pos          token.Pos
+}
+
+// applyStackDefaults fills stackValue with the StackDefaults that apply to it, in order:
+// Paths whose regexp matches the directory of the stack relative to the cue root,
+// then Environments matching its Environment, then RegionCodes matching its RegionCode, or the code of its Region.
+// A default only fills the fields that neither the stack nor an earlier default set to a concrete value
+func applyStackDefaults(config *Config, dir string, stackValue cue.Value) (cue.Value, []StackDefault, error) {
+	if !config.StackDefaults.Exists() {
+		return stackValue, nil, nil
+	}
+
+	var applied []StackDefault
+	apply := func(source string, value cue.Value) {
+		var fields []DefaultedField
+		stackValue, fields = fillStackDefault(stackValue, source, nil, value, nil)
+		applied = append(applied, StackDefault{Source: source, Value: value, Fields: fields})
+	}
+
+	relativeDir, relativeDirErr := filepath.Rel(config.CueRoot, dir)
+	if relativeDirErr != nil {
+		relativeDir = dir
+	}
+	relativeDir = filepath.ToSlash(relativeDir)
+
+	paths, pathsErr := stackDefaultsOf(config.StackDefaults, "Paths")
+	if pathsErr != nil {
+		return stackValue, nil, pathsErr
+	}
+	for _, path := range paths {
+		pathRegexp, pathRegexpErr := regexp.Compile(path.key)
+		if pathRegexpErr != nil {
+			return stackValue, nil, fmt.Errorf("StackDefaults.Paths: %s", pathRegexpErr)
+		}
+		if pathRegexp.MatchString(relativeDir) {
+			apply("Paths."+path.key, path.value)
+		}
+	}
+
+	environment, _ := stackValue.LookupPath(cue.ParsePath("Environment")).String()
+	environments, environmentsErr := stackDefaultsOf(config.StackDefaults, "Environments")
+	if environmentsErr != nil {
+		return stackValue, nil, environmentsErr
+	}
+	for _, environmentDefault := range environments {
+		if environmentDefault.key == environment {
+			apply("Environments."+environment, environmentDefault.value)
+		}
+	}
+
+	regionCode, _ := stackValue.LookupPath(cue.ParsePath("RegionCode")).String()
+	if regionCode == "" {
+		region, _ := stackValue.LookupPath(cue.ParsePath("Region")).String()
+		regionCode = config.GetRegionCode(region)
+	}
+	regionCodes, regionCodesErr := stackDefaultsOf(config.StackDefaults, "RegionCodes")
+	if regionCodesErr != nil {
+		return stackValue, nil, regionCodesErr
+	}
+	for _, regionCodeDefault := range regionCodes {
+		if regionCodeDefault.key == regionCode {
+			apply("RegionCodes."+regionCode, regionCodeDefault.value)
+		}
+	}
+
+	return stackValue, applied, stackValue.Err()
+}
+
+type keyedStackDefault struct {
+	key   string
+	value cue.Value
+}
+
+// stackDefaultsOf returns the entries of StackDefaults[kind] in declaration order
+func stackDefaultsOf(stackDefaults cue.Value, kind string) ([]keyedStackDefault, error) {
+	kindValue := stackDefaults.LookupPath(cue.ParsePath(kind))
+	if !kindValue.Exists() {
+		return nil, nil
+	}
+	fields, fieldsErr := kindValue.Fields()
+	if fieldsErr != nil {
+		return nil, fieldsErr
+	}
+	var keyed []keyedStackDefault
+	for fields.Next() {
+		keyed = append(keyed, keyedStackDefault{key: fields.Label(), value: fields.Value()})
+	}
+	return keyed, nil
+}
+
+// fillStackDefault fills stackValue with the leaves of value, at path, that stackValue does not set to a concrete value,
+// and appends them to fields. Fields the stack leaves open, such as a string or a disjunction with a default, are
+// unified with the default
+func fillStackDefault(stackValue cue.Value, source string, path []cue.Selector, value cue.Value, fields []DefaultedField) (cue.Value, []DefaultedField) {
+	if value.IncompleteKind() == cue.StructKind {
+		iter, iterErr := value.Fields()
+		if iterErr == nil {
+			leaf := true
+			for iter.Next() {
+				leaf = false
+				fieldPath := append(append([]cue.Selector{}, path...), iter.Selector())
+				stackValue, fields = fillStackDefault(stackValue, source, fieldPath, iter.Value(), fields)
+			}
+			if !leaf {
+				return stackValue, fields
+			}
+		}
+	}
+	if len(path) == 0 {
+		return stackValue, fields
+	}
+
+	cuePath := cue.MakePath(path...)
+	if current := stackValue.LookupPath(cuePath); current.Exists() && current.IsConcrete() {
+		return stackValue, fields
+	}
+	// the config is evaluated by another runtime than the stack, so the leaf is placed at its path in its own runtime
+	field := value.Context().CompileString("{}").FillPath(cuePath, value)
+	return stackValue.Unify(field), append(fields, DefaultedField{Path: cuePath.String(), Source: source, Pos: value.Pos()})
+}
+
+// DefaultedFields lists the fields supplied by each default, down to the leaves
+func DefaultedFields(defaults []StackDefault) []DefaultedField {
+	var defaultedFields []DefaultedField
+	for _, stackDefault := range defaults {
+		defaultedFields = append(defaultedFields, stackDefault.Fields...)
+	}
+	return defaultedFields
+}
@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+// testStackDefaults compiles the StackDefaults of a config in its own runtime, like config files are
+func testStackDefaults(t *testing.T, src string) *Config {
+	t.Helper()
+	stackDefaults := cuecontext.New().CompileString(src, cue.Filename(configFileName))
+	if stackDefaults.Err() != nil {
+		t.Fatal(stackDefaults.Err())
+	}
+	return &Config{
+		CueRoot:       "/stax",
+		Environments:  []string{"qa", "prod"},
+		RegionCodes:   map[string]string{"use1": "us-east-1", "usw2": "us-west-2"},
+		StackDefaults: stackDefaults,
+	}
+}
+
+func TestApplyStackDefaults(t *testing.T) {
+	config := testStackDefaults(t, `
+RegionCodes: usw2: {
+	Profile: "region"
+	Tags: Region: "usw2"
+	TagsEnabled: false
+}
+Environments: qa: {
+	Profile: "env"
+	Tags: Environment: "qa"
+}
+Paths: "^app": {
+	Profile: "path"
+}
+Paths: "^other": {
+	Profile: "other"
+}
+`)
+
+	tests := []struct {
+		name, dir, stack string
+		// want are the values of the stack after the defaults
+		want map[string]string
+		// wantSources are the applied defaults, in order
+		wantSources []string
+		// wantFields are the defaulted fields, as path=source
+		wantFields []string
+	}{
+		{
+			name:  "Paths then Environments then RegionCodes",
+			dir:   "/stax/app/web",
+			stack: `Environment: "qa", RegionCode: "usw2"`,
+			want: map[string]string{
+				"Profile":          "path",
+				"Tags.Environment": "qa",
+				"Tags.Region":      "usw2",
+				"TagsEnabled":      "false",
+			},
+			wantSources: []string{"Paths.^app", "Environments.qa", "RegionCodes.usw2"},
+			wantFields:  []string{"Profile=Paths.^app", "Tags.Environment=Environments.qa", "Tags.Region=RegionCodes.usw2", "TagsEnabled=RegionCodes.usw2"},
+		},
+		{
+			name:        "Environments before RegionCodes",
+			dir:         "/stax/lib",
+			stack:       `Environment: "qa", RegionCode: "usw2"`,
+			want:        map[string]string{"Profile": "env"},
+			wantSources: []string{"Environments.qa", "RegionCodes.usw2"},
+			wantFields:  []string{"Profile=Environments.qa", "Tags.Environment=Environments.qa", "Tags.Region=RegionCodes.usw2", "TagsEnabled=RegionCodes.usw2"},
+		},
+		{
+			name:        "region code from Region",
+			dir:         "/stax/lib",
+			stack:       `Environment: "prod", Region: "us-west-2"`,
+			want:        map[string]string{"Profile": "region"},
+			wantSources: []string{"RegionCodes.usw2"},
+			wantFields:  []string{"Profile=RegionCodes.usw2", "Tags.Region=RegionCodes.usw2", "TagsEnabled=RegionCodes.usw2"},
+		},
+		{
+			name:  "values set by the stack are kept",
+			dir:   "/stax/app",
+			stack: `Environment: "qa", RegionCode: "usw2", Profile: "stack", Tags: Region: "stack", TagsEnabled: true`,
+			want: map[string]string{
+				"Profile":          "stack",
+				"Tags.Environment": "qa",
+				"Tags.Region":      "stack",
+				"TagsEnabled":      "true",
+			},
+			wantSources: []string{"Paths.^app", "Environments.qa", "RegionCodes.usw2"},
+			wantFields:  []string{"Tags.Environment=Environments.qa"},
+		},
+		{
+			name:        "open values are unified with the default",
+			dir:         "/stax/lib",
+			stack:       `Environment: "prod", RegionCode: "usw2", Profile: string, TagsEnabled: *true | false`,
+			want:        map[string]string{"Profile": "region", "TagsEnabled": "false"},
+			wantSources: []string{"RegionCodes.usw2"},
+			wantFields:  []string{"Profile=RegionCodes.usw2", "Tags.Region=RegionCodes.usw2", "TagsEnabled=RegionCodes.usw2"},
+		},
+		{
+			name:  "no matching default",
+			dir:   "/stax/lib",
+			stack: `Environment: "prod", RegionCode: "use1", Profile: "stack"`,
+			want:  map[string]string{"Profile": "stack"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stackValue := cuecontext.New().CompileString(test.stack)
+			stackValue, defaults, defaultsErr := applyStackDefaults(config, test.dir, stackValue)
+			if defaultsErr != nil {
+				t.Fatal(defaultsErr)
+			}
+
+			for path, want := range test.want {
+				value := stackValue.LookupPath(cue.ParsePath(path))
+				if defaultValue, ok := value.Default(); ok {
+					value = defaultValue
+				}
+				got, gotErr := value.MarshalJSON()
+				if gotErr != nil {
+					t.Fatalf("%s: %v", path, gotErr)
+				}
+				if strings.Trim(string(got), `"`) != want {
+					t.Errorf("%s: expected %s, got %s", path, want, got)
+				}
+			}
+
+			var sources []string
+			for _, stackDefault := range defaults {
+				sources = append(sources, stackDefault.Source)
+			}
+			if !reflect.DeepEqual(sources, test.wantSources) {
+				t.Errorf("expected defaults %v, got %v", test.wantSources, sources)
+			}
+
+			var fields []string
+			for _, field := range DefaultedFields(defaults) {
+				fields = append(fields, field.Path+"="+field.Source)
+				if !field.Pos.IsValid() || field.Pos.Filename() != configFileName {
+					t.Errorf("%s: expected a position in %s, got %s", field.Path, configFileName, field.Pos)
+				}
+			}
+			if !reflect.DeepEqual(fields, test.wantFields) {
+				t.Errorf("expected fields %v, got %v", test.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestApplyStackDefaultsInvalidPath(t *testing.T) {
+	config := testStackDefaults(t, `Paths: "^app(": Profile: "path"`)
+	_, _, defaultsErr := applyStackDefaults(config, "/stax/app", cuecontext.New().CompileString(`Environment: "qa"`))
+	if defaultsErr == nil || !strings.Contains(defaultsErr.Error(), "StackDefaults.Paths") {
+		t.Fatalf("expected an invalid Paths regexp error, got %v", defaultsErr)
+	}
+}
+
+func TestAmbiguousValues(t *testing.T) {
+	tests := []struct {
+		name, value string
+		// wantPaths are the fields reported as ambiguous
+		wantPaths []string
+	}{
+		{name: "concrete values", value: `Profile: "p", TagsEnabled: true`},
+		{name: "single default", value: `TagsEnabled: *true | false`},
+		{name: "defaults that agree", value: `TagsEnabled: (*true | false) & (*true | false)`},
+		{name: "defaults that disagree", value: `TagsEnabled: (*true | false) & (*false | true)`, wantPaths: []string{"TagsEnabled"}},
+		{name: "nested", value: `Tags: Team: (*"a" | "b") & (*"b" | "a")`, wantPaths: []string{"Tags.Team"}},
+		{name: "resolved by a concrete value", value: `TagsEnabled: (*true | false) & (*false | true) & false`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := cuecontext.New().CompileString(test.value)
+			if value.Err() != nil {
+				t.Fatal(value.Err())
+			}
+			ambiguousErr := ambiguousValues(value)
+			if len(test.wantPaths) == 0 {
+				if ambiguousErr != nil {
+					t.Fatalf("expected no error, got %v", ambiguousErr)
+				}
+				return
+			}
+			if ambiguousErr == nil {
+				t.Fatal("expected an ambiguous value error")
+			}
+			for _, path := range test.wantPaths {
+				if !strings.Contains(ambiguousErr.Error(), path+": ambiguous value") {
+					t.Errorf("expected %s to be ambiguous, got %v", path, ambiguousErr)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyStackDefaultsAmbiguous(t *testing.T) {
+	config := testStackDefaults(t, `Environments: qa: TagsEnabled: *false | true`)
+	stackValue, _, defaultsErr := applyStackDefaults(config, "/stax/app", cuecontext.New().CompileString(`Environment: "qa", TagsEnabled: *true | false`))
+	if defaultsErr != nil {
+		t.Fatal(defaultsErr)
+	}
+	// a default unified with a stack default is left for validation to report
+	if ambiguousErr := ambiguousValues(stackValue); ambiguousErr == nil || !strings.Contains(ambiguousErr.Error(), "TagsEnabled: ambiguous value") {
+		t.Fatalf("expected TagsEnabled to be ambiguous, got %v", ambiguousErr)
+	}
+}
@@ -1,16 +1,21 @@
 package internal
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 
 	"cuelang.org/go/cue"
 	"github.com/cue-sh/stax/logger"
 )
 
+// Override is a source of parameter values, see NewOverrideSource
 type Override struct {
-	SopsProfile string
-	Map         map[string]string
+	Source, SopsProfile, Profile, Region string
+	Reference                            bool
+	Map                                  map[string]string
 }
 
 // Stack represents the decoded value of stacks[stackname]
@@ -21,17 +26,28 @@ type Stack struct {
 	Role                                           string
 	Tags                                           map[string]string
 	TagsEnabled                                    bool
+	ResourcesToImport                              map[string]ResourceToImport
+	EnableTerminationProtection                    *bool
+	NotificationARNs                               []string
+	Timeouts                                       struct {
+		ChangeSet, Stack string
+	}
 }
 
 // StacksIterator is a wrapper around cue.Iterator that allows for filtering based on stack fields
 type StacksIterator struct {
-	cueIter *cue.Iterator
-	flags   Flags
-	log     *logger.Logger
+	ctx             context.Context
+	cueIter         *cue.Iterator
+	currentValue    cue.Value
+	currentDefaults []StackDefault
+	dir             string
+	config          *Config
+	flags           Flags
+	log             *logger.Logger
 }
 
 // NewStacksIterator returns *StacksIterator
-func NewStacksIterator(cueInstance *cue.Instance, flags Flags, log *logger.Logger) (*StacksIterator, error) {
+func NewStacksIterator(ctx context.Context, cueInstance *cue.Instance, config *Config, flags Flags, log *logger.Logger) (*StacksIterator, error) {
 	log.Debug("Getting stacks...")
 	stacks := cueInstance.Value().LookupPath(cue.ParsePath("Stacks"))
 	if !stacks.Exists() {
@@ -43,16 +59,18 @@ func NewStacksIterator(cueInstance *cue.Instance, flags Flags, log *logger.Logge
 		return nil, fieldsErr
 	}
 
-	return &StacksIterator{cueIter: fields, flags: flags, log: log}, nil
+	return &StacksIterator{ctx: ctx, cueIter: fields, dir: cueInstance.Dir, config: config, flags: flags, log: log}, nil
 }
 
 // Next moves the index forward and applies global filters. returns true if there is a value that passes the filters
 func (it *StacksIterator) Next() bool {
-	if !it.cueIter.Next() {
+	// no new stacks once interrupted
+	if it.ctx.Err() != nil || !it.cueIter.Next() {
+		it.log.SetStack("", "", "")
 		return false
 	}
 
-	currentValue := it.cueIter.Value()
+	currentValue, currentDefaults, completeErr := CompleteStack(it.config, it.dir, it.cueIter.Value())
 	if it.flags.StackNameRegexPattern != "" {
 		stackName, _ := currentValue.Label()
 		var stackNameRegexp *regexp.Regexp
@@ -76,7 +94,7 @@ func (it *StacksIterator) Next() bool {
 		}
 		environment, environmentErr := environmentValue.String()
 		if environmentErr != nil {
-			it.log.Error(environmentErr)
+			it.log.Error(StackError(environmentErr, nil, currentValue))
 			return it.Next()
 		}
 		if it.flags.Environment != environment {
@@ -91,7 +109,7 @@ func (it *StacksIterator) Next() bool {
 		}
 		regionCode, regionCodeErr := regionCodeValue.String()
 		if regionCodeErr != nil {
-			it.log.Error(regionCodeErr)
+			it.log.Error(StackError(regionCodeErr, nil, currentValue))
 			return it.Next()
 		}
 		if it.flags.RegionCode != regionCode {
@@ -107,7 +125,7 @@ func (it *StacksIterator) Next() bool {
 		}
 		profile, profileErr := profileValue.String()
 		if profileErr != nil {
-			it.log.Error(profileErr)
+			it.log.Error(StackError(profileErr, nil, currentValue))
 			return it.Next()
 		}
 		if it.flags.Profile != profile {
@@ -123,10 +141,79 @@ func (it *StacksIterator) Next() bool {
 		}
 	}
 
+	// only report invalid stacks that pass the filters
+	if completeErr != nil {
+		it.log.Error(StackError(completeErr, nil, it.cueIter.Value()))
+		it.log.SetExitCode(logger.ExitValidation)
+		return it.Next()
+	}
+
+	it.currentValue = currentValue
+	it.currentDefaults = currentDefaults
+
+	// entries logged while the stack is processed carry its name, profile and region
+	name, _ := currentValue.LookupPath(cue.ParsePath("Name")).String()
+	profile, _ := currentValue.LookupPath(cue.ParsePath("Profile")).String()
+	region, _ := currentValue.LookupPath(cue.ParsePath("Region")).String()
+	it.log.SetStack(name, profile, region)
 	return true
 }
 
-// Value returns the value from the cue.Iterator
+// Value returns the current stack, unified with StackSchema and StackDefaults and with Region or RegionCode derived
+// from the other
 func (it *StacksIterator) Value() cue.Value {
-	return it.cueIter.Value()
+	return it.currentValue
+}
+
+// Defaults returns the StackDefaults applied to the current stack
+func (it *StacksIterator) Defaults() []StackDefault {
+	return it.currentDefaults
+}
+
+// CompleteStack unifies stackValue with the configured StackSchema and the StackDefaults that apply to it,
+// derives Region from RegionCode or RegionCode from Region when only one is set, validates Environment, RegionCode
+// and Region against the configured values, and finally validates the stack against core.#StackSettings.
+// dir is the directory of the stack's instance, it returns the applied defaults
+func CompleteStack(config *Config, dir string, stackValue cue.Value) (cue.Value, []StackDefault, error) {
+	if config.StackSchema.Exists() {
+		stackValue = stackValue.Unify(config.StackSchema)
+		if stackValue.Err() != nil {
+			return stackValue, nil, stackValue.Err()
+		}
+	}
+
+	stackValue, defaults, defaultsErr := applyStackDefaults(config, dir, stackValue)
+	if defaultsErr != nil {
+		return stackValue, defaults, defaultsErr
+	}
+
+	environment, _ := stackValue.LookupPath(cue.ParsePath("Environment")).String()
+	regionCode, _ := stackValue.LookupPath(cue.ParsePath("RegionCode")).String()
+	region, _ := stackValue.LookupPath(cue.ParsePath("Region")).String()
+
+	if environment != "" && !config.IsEnvironment(environment) {
+		return stackValue, defaults, fmt.Errorf("Environment %q is not one of %s", environment, strings.Join(config.Environments, ", "))
+	}
+
+	if regionCode != "" {
+		regionCodeRegion, ok := config.RegionCodes[regionCode]
+		if !ok {
+			return stackValue, defaults, fmt.Errorf("RegionCode %q is not declared in RegionCodes", regionCode)
+		}
+		if region == "" {
+			region = regionCodeRegion
+			stackValue = stackValue.FillPath(cue.ParsePath("Region"), region)
+		} else if region != regionCodeRegion {
+			return stackValue, defaults, fmt.Errorf("Region %q does not match RegionCode %q (%s)", region, regionCode, regionCodeRegion)
+		}
+	} else if region != "" {
+		regionCode = config.GetRegionCode(region)
+		if regionCode == "" {
+			return stackValue, defaults, fmt.Errorf("Region %q is not declared in RegionCodes", region)
+		}
+		stackValue = stackValue.FillPath(cue.ParsePath("RegionCode"), regionCode)
+	}
+
+	stackValue, validateErr := ValidateStack(config, stackValue)
+	return stackValue, defaults, validateErr
 }
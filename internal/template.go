@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/token"
+)
+
+// pseudo parameters substituted for hardcoded values in imported templates
+const (
+	pseudoRegion    = "AWS::Region"
+	pseudoAccountID = "AWS::AccountId"
+)
+
+// templateSections holds the top level template sections that are left untouched:
+// Parameters keep their original defaults, Mappings and Metadata only allow literals,
+// and Conditions compare against literal regions and accounts on purpose.
+var templateSections = map[string]bool{"Parameters": true, "Mappings": true, "Metadata": true, "Conditions": true}
+
+// arnRegexp matches the partition, service, region and account segments of an ARN, the region and account are
+// empty for global services such as s3
+var arnRegexp = regexp.MustCompile(`arn:([\w-]+):([\w-]+):([\w-]*):(\d*):`)
+
+type idiomatic struct {
+	region, accountID string
+}
+
+// IdiomaticTemplate rewrites a template extracted from CloudFormation JSON so it can be maintained in Cue:
+// Fn::Join of literals, Refs and Fn::GetAtts becomes Fn::Sub,
+// hardcoded region and account ids, as whole values or ARN segments, become the AWS::Region and AWS::AccountId
+// pseudo parameters, and a value consisting solely of a pseudo parameter is always a Ref while anything else is a
+// Fn::Sub.
+func IdiomaticTemplate(template ast.Expr, region, accountID string) ast.Expr {
+	templateStruct, ok := template.(*ast.StructLit)
+	if !ok {
+		return template
+	}
+
+	i := idiomatic{region: region, accountID: accountID}
+
+	for _, decl := range templateStruct.Elts {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		label, _, _ := ast.LabelName(field.Label)
+		if templateSections[label] {
+			continue
+		}
+		field.Value = i.expr(field.Value)
+	}
+	return templateStruct
+}
+
+func (i idiomatic) expr(expr ast.Expr) ast.Expr {
+	switch x := expr.(type) {
+	case *ast.ListLit:
+		for j, elt := range x.Elts {
+			x.Elts[j] = i.expr(elt)
+		}
+		return x
+
+	case *ast.BasicLit:
+		str, ok := stringLit(x)
+		if !ok {
+			return x
+		}
+		return subOrRef(i.replace(escapeSub(str)), x)
+
+	case *ast.StructLit:
+		intrinsic, value := singleField(x)
+		switch intrinsic {
+		case "Ref", "Condition":
+			return x
+
+		case "Fn::GetAZs":
+			// Fn::GetAZs only accepts a literal region or a Ref to AWS::Region
+			if str, ok := stringLit(value); ok && str == i.region {
+				x.Elts[0].(*ast.Field).Value = ast.NewStruct(&ast.Field{Label: ast.NewString("Ref"), Value: ast.NewString(pseudoRegion)})
+			}
+			return x
+
+		case "Fn::Sub":
+			if str, ok := stringLit(value); ok {
+				return subOrRef(i.replace(str), x)
+			}
+			if list, ok := value.(*ast.ListLit); ok && len(list.Elts) > 0 {
+				if str, ok := stringLit(list.Elts[0]); ok {
+					list.Elts[0] = ast.NewString(i.replace(str))
+				}
+				for j := 1; j < len(list.Elts); j++ {
+					list.Elts[j] = i.expr(list.Elts[j])
+				}
+			}
+			return x
+
+		case "Fn::Join":
+			if sub, ok := joinToSub(value); ok {
+				return subOrRef(i.replace(sub), x)
+			}
+		}
+
+		for _, decl := range x.Elts {
+			if field, ok := decl.(*ast.Field); ok {
+				field.Value = i.expr(field.Value)
+			}
+		}
+		return x
+	}
+	return expr
+}
+
+// replace substitutes the pseudo parameters for the region or account id when they are the whole value, or the
+// region and account segments of the ARNs in str. Other occurrences, such as the region in an availability zone
+// or a run of digits in a name, are left as is
+func (i idiomatic) replace(str string) string {
+	switch {
+	case i.region != "" && str == i.region:
+		return "${" + pseudoRegion + "}"
+	case i.accountID != "" && str == i.accountID:
+		return "${" + pseudoAccountID + "}"
+	}
+	return arnRegexp.ReplaceAllStringFunc(str, func(arn string) string {
+		segments := arnRegexp.FindStringSubmatch(arn)
+		region, accountID := segments[3], segments[4]
+		if i.region != "" && region == i.region {
+			region = "${" + pseudoRegion + "}"
+		}
+		if i.accountID != "" && accountID == i.accountID {
+			accountID = "${" + pseudoAccountID + "}"
+		}
+		return "arn:" + segments[1] + ":" + segments[2] + ":" + region + ":" + accountID + ":"
+	})
+}
+
+// subOrRef returns a Ref when sub is a single pseudo parameter, a Fn::Sub when sub has variables, or else the original
+func subOrRef(sub string, original ast.Expr) ast.Expr {
+	if strings.HasPrefix(sub, "${AWS::") && strings.Index(sub, "}") == len(sub)-1 {
+		return ast.NewStruct(&ast.Field{Label: ast.NewString("Ref"), Value: ast.NewString(sub[2 : len(sub)-1])})
+	}
+	if strings.Contains(strings.ReplaceAll(sub, "${!", ""), "${") {
+		return ast.NewStruct(&ast.Field{Label: ast.NewString("Fn::Sub"), Value: ast.NewString(sub)})
+	}
+	if _, ok := original.(*ast.BasicLit); ok {
+		return original
+	}
+	return ast.NewString(strings.ReplaceAll(sub, "${!", "${"))
+}
+
+// joinToSub converts the value of a Fn::Join into a Fn::Sub string when the join delimiter is empty
+// and every element is a string, a Ref, or a Fn::GetAtt
+func joinToSub(join ast.Expr) (string, bool) {
+	list, ok := join.(*ast.ListLit)
+	if !ok || len(list.Elts) != 2 {
+		return "", false
+	}
+	delimiter, ok := stringLit(list.Elts[0])
+	if !ok || delimiter != "" {
+		return "", false
+	}
+	parts, ok := list.Elts[1].(*ast.ListLit)
+	if !ok {
+		return "", false
+	}
+
+	var sub strings.Builder
+	for _, part := range parts.Elts {
+		if str, ok := stringLit(part); ok {
+			sub.WriteString(escapeSub(str))
+			continue
+		}
+		partStruct, ok := part.(*ast.StructLit)
+		if !ok {
+			return "", false
+		}
+		intrinsic, value := singleField(partStruct)
+		switch intrinsic {
+		case "Ref":
+			ref, ok := stringLit(value)
+			if !ok {
+				return "", false
+			}
+			sub.WriteString("${" + ref + "}")
+		case "Fn::GetAtt":
+			getAtt, ok := value.(*ast.ListLit)
+			if !ok || len(getAtt.Elts) != 2 {
+				return "", false
+			}
+			resource, resourceOk := stringLit(getAtt.Elts[0])
+			attribute, attributeOk := stringLit(getAtt.Elts[1])
+			if !resourceOk || !attributeOk {
+				return "", false
+			}
+			sub.WriteString("${" + resource + "." + attribute + "}")
+		default:
+			return "", false
+		}
+	}
+	return sub.String(), true
+}
+
+// escapeSub escapes literal ${ so Fn::Sub does not treat it as a variable
+func escapeSub(str string) string {
+	return strings.ReplaceAll(str, "${", "${!")
+}
+
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	str, err := literal.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	return str, true
+}
+
+// singleField returns the label and value of a struct with exactly one field, as intrinsic functions are
+func singleField(x *ast.StructLit) (string, ast.Expr) {
+	if len(x.Elts) != 1 {
+		return "", nil
+	}
+	field, ok := x.Elts[0].(*ast.Field)
+	if !ok {
+		return "", nil
+	}
+	label, _, err := ast.LabelName(field.Label)
+	if err != nil {
+		return "", nil
+	}
+	return label, field.Value
+}
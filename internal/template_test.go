@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+)
+
+func TestIdiomaticTemplate(t *testing.T) {
+	tests := []struct {
+		name, value, want string
+	}{
+		{
+			name:  "region becomes a Ref",
+			value: `"us-west-2"`,
+			want:  `{Ref: "AWS::Region"}`,
+		},
+		{
+			name:  "account id becomes a Ref",
+			value: `"123456789012"`,
+			want:  `{Ref: "AWS::AccountId"}`,
+		},
+		{
+			name:  "arn segments become a Fn::Sub",
+			value: `"arn:aws:sns:us-west-2:123456789012:alerts"`,
+			want:  `{"Fn::Sub": "arn:aws:sns:${AWS::Region}:${AWS::AccountId}:alerts"}`,
+		},
+		{
+			name:  "availability zone is unchanged",
+			value: `"us-west-2a"`,
+			want:  `"us-west-2a"`,
+		},
+		{
+			name:  "digits in a name are unchanged",
+			value: `"bucket-123456789012-logs"`,
+			want:  `"bucket-123456789012-logs"`,
+		},
+		{
+			name:  "literal variable syntax is unchanged",
+			value: `"${NotAVariable}"`,
+			want:  `"${NotAVariable}"`,
+		},
+		{
+			name:  "Fn::Join of literals and Refs becomes a Fn::Sub",
+			value: `{"Fn::Join": ["", ["arn:aws:s3:::", {Ref: "Bucket"}, "/*"]]}`,
+			want:  `{"Fn::Sub": "arn:aws:s3:::${Bucket}/*"}`,
+		},
+		{
+			name:  "Fn::Join with Fn::GetAtt becomes a Fn::Sub",
+			value: `{"Fn::Join": ["", [{"Fn::GetAtt": ["Database", "Endpoint.Address"]}, ":5432"]]}`,
+			want:  `{"Fn::Sub": "${Database.Endpoint.Address}:5432"}`,
+		},
+		{
+			name:  "Fn::Join with a delimiter is unchanged",
+			value: `{"Fn::Join": [",", ["a", "b"]]}`,
+			want:  `{"Fn::Join": [",", ["a", "b"]]}`,
+		},
+		{
+			name:  "Fn::Join of the region becomes a Ref",
+			value: `{"Fn::Join": ["", [{Ref: "AWS::Region"}]]}`,
+			want:  `{Ref: "AWS::Region"}`,
+		},
+		{
+			name:  "Fn::Sub of the account id becomes a Ref",
+			value: `{"Fn::Sub": "123456789012"}`,
+			want:  `{Ref: "AWS::AccountId"}`,
+		},
+		{
+			name:  "Fn::GetAZs of the region",
+			value: `{"Fn::GetAZs": "us-west-2"}`,
+			want:  `{"Fn::GetAZs": {Ref: "AWS::Region"}}`,
+		},
+		{
+			name:  "lists are rewritten",
+			value: `["us-west-2", "us-west-2b"]`,
+			want:  `[{Ref: "AWS::Region"}, "us-west-2b"]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := idiomaticJSON(t, `{Resources: Topic: Properties: Value: `+test.value+`}`)
+			want := compileJSON(t, `{Resources: Topic: Properties: Value: `+test.want+`}`)
+			if got != want {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestIdiomaticTemplateSections(t *testing.T) {
+	template := `{
+		Parameters: Region: Default: "us-west-2"
+		Conditions: IsWest: {"Fn::Equals": [{Ref: "AWS::Region"}, "us-west-2"]}
+		Mappings: Regions: "us-west-2": Account: "123456789012"
+		Resources: Topic: Properties: Region: "us-west-2"
+	}`
+	want := `{
+		Parameters: Region: Default: "us-west-2"
+		Conditions: IsWest: {"Fn::Equals": [{Ref: "AWS::Region"}, "us-west-2"]}
+		Mappings: Regions: "us-west-2": Account: "123456789012"
+		Resources: Topic: Properties: Region: {Ref: "AWS::Region"}
+	}`
+	if got, want := idiomaticJSON(t, template), compileJSON(t, want); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func idiomaticJSON(t *testing.T, template string) string {
+	t.Helper()
+	expr, parseErr := parser.ParseExpr("template", template)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	value := cuecontext.New().BuildExpr(IdiomaticTemplate(expr, "us-west-2", "123456789012"))
+	json, jsonErr := value.MarshalJSON()
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	return string(json)
+}
+
+func compileJSON(t *testing.T, src string) string {
+	t.Helper()
+	json, jsonErr := cuecontext.New().CompileString(src).MarshalJSON()
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	return string(json)
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+)
+
+// Waiter polls with exponential backoff, from Interval doubling up to MaxInterval, until Timeout
+type Waiter struct {
+	Timeout, Interval, MaxInterval time.Duration
+}
+
+// WaitTimeoutError is returned when a waiter times out, the operation is left running
+type WaitTimeoutError struct {
+	Resource string
+	Status   string
+	Timeout  time.Duration
+}
+
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for %s, still %s", e.Timeout, e.Resource, e.Status)
+}
+
+// ChangeSetWaiter returns the waiter of the change sets of stack, its Timeouts.ChangeSet overrides
+// Cmd.Deploy.ChangeSetTimeout
+func ChangeSetWaiter(config *Config, stack Stack) (Waiter, error) {
+	timeout := config.Cmd.Deploy.ChangeSetTimeout
+	if stack.Timeouts.ChangeSet != "" {
+		timeout = stack.Timeouts.ChangeSet
+	}
+	return newWaiter(config, timeout)
+}
+
+// StackWaiter returns the waiter of stack operations, its Timeouts.Stack overrides Cmd.Deploy.StackTimeout
+func StackWaiter(config *Config, stack Stack) (Waiter, error) {
+	timeout := config.Cmd.Deploy.StackTimeout
+	if stack.Timeouts.Stack != "" {
+		timeout = stack.Timeouts.Stack
+	}
+	return newWaiter(config, timeout)
+}
+
+func newWaiter(config *Config, timeout string) (Waiter, error) {
+	var waiter Waiter
+	var parseErr error
+	if waiter.Timeout, parseErr = time.ParseDuration(timeout); parseErr != nil {
+		return waiter, parseErr
+	}
+	if waiter.Interval, parseErr = time.ParseDuration(config.Cmd.Deploy.PollInterval); parseErr != nil {
+		return waiter, parseErr
+	}
+	if waiter.MaxInterval, parseErr = time.ParseDuration(config.Cmd.Deploy.MaxPollInterval); parseErr != nil {
+		return waiter, parseErr
+	}
+	if waiter.MaxInterval < waiter.Interval {
+		waiter.MaxInterval = waiter.Interval
+	}
+	return waiter, nil
+}
+
+// wait calls poll until it is done, returns ctx.Err() when interrupted and *WaitTimeoutError on timeout.
+// poll returns the status it observed. Transient errors, such as throttling, are retried with the same backoff until
+// the deadline, any other error ends the wait
+func (w Waiter) wait(ctx context.Context, resource string, poll func() (done bool, status string, err error)) error {
+	deadline := time.Now().Add(w.Timeout)
+	interval := w.Interval
+	var lastStatus string
+	for {
+		done, status, pollErr := poll()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if pollErr != nil && !IsTransient(pollErr) {
+			return pollErr
+		}
+		if pollErr == nil && done {
+			return nil
+		}
+		if status != "" {
+			lastStatus = status
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return &WaitTimeoutError{Resource: resource, Status: lastStatus, Timeout: w.Timeout}
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		if sleepErr := Sleep(ctx, interval); sleepErr != nil {
+			return sleepErr
+		}
+
+		interval *= 2
+		if interval > w.MaxInterval {
+			interval = w.MaxInterval
+		}
+	}
+}
+
+// WaitForChangeSet waits until the change set is no longer pending or being created, or deleted
+func (w Waiter) WaitForChangeSet(ctx context.Context, cfn *cloudformation.Client, stackName, changeSetName string) (*cloudformation.DescribeChangeSetOutput, error) {
+	var output *cloudformation.DescribeChangeSetOutput
+	waitErr := w.wait(ctx, "change set "+changeSetName, func() (bool, string, error) {
+		var describeErr error
+		output, describeErr = cfn.DescribeChangeSet(ctx, &cloudformation.DescribeChangeSetInput{
+			ChangeSetName: aws.String(changeSetName),
+			StackName:     aws.String(stackName),
+		})
+		if describeErr != nil {
+			return false, "", describeErr
+		}
+		switch output.Status {
+		case types.ChangeSetStatusCreatePending, types.ChangeSetStatusCreateInProgress, types.ChangeSetStatusDeletePending, types.ChangeSetStatusDeleteInProgress:
+			return false, string(output.Status), nil
+		}
+		return true, string(output.Status), nil
+	})
+	return output, waitErr
+}
+
+// WaitForStack waits until the stack reaches a terminal status, see StackStatusInProgress.
+// A stack that no longer exists is DELETE_COMPLETE. Returns the last status observed, including on timeout or interrupt
+func (w Waiter) WaitForStack(ctx context.Context, cfn *cloudformation.Client, stackName string) (types.StackStatus, error) {
+	var status types.StackStatus
+	waitErr := w.wait(ctx, "stack "+stackName, func() (bool, string, error) {
+		output, describeErr := cfn.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stackName)})
+		if describeErr != nil {
+			if IsStackNotFound(describeErr) {
+				status = types.StackStatusDeleteComplete
+				return true, string(status), nil
+			}
+			return false, string(status), describeErr
+		}
+		status = output.Stacks[0].StackStatus
+		return !StackStatusInProgress(status), string(status), nil
+	})
+	return status, waitErr
+}
+
+// StackStatusInProgress returns true for the statuses of an operation in progress, REVIEW_IN_PROGRESS included
+// since a stack created by a change set stays in review until the change set is executed
+func StackStatusInProgress(status types.StackStatus) bool {
+	return strings.HasSuffix(string(status), "_IN_PROGRESS")
+}
+
+// StackStatusSucceeded returns true for the terminal statuses of an operation that succeeded
+func StackStatusSucceeded(status types.StackStatus) bool {
+	switch status {
+	case types.StackStatusCreateComplete, types.StackStatusUpdateComplete, types.StackStatusImportComplete, types.StackStatusDeleteComplete:
+		return true
+	}
+	return false
+}
+
+// StackStatusRolledBack returns true for the terminal statuses of an operation that was rolled back
+func StackStatusRolledBack(status types.StackStatus) bool {
+	return !StackStatusInProgress(status) && strings.Contains(string(status), "ROLLBACK")
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestWaiterWait(t *testing.T) {
+	fatalErr := errors.New("access denied")
+	throttlingErr := &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}
+	tests := []struct {
+		name string
+		// polls is the number of polls before done, or -1 to never be done
+		polls int
+		// pollErrs are returned by the first polls, before done is
+		pollErrs []error
+		waiter   Waiter
+		wantErr  func(error) bool
+		// wantPolls is the exact number of polls, 0 to skip the check
+		wantPolls int
+		// maxElapsed bounds the time the wait may take
+		maxElapsed time.Duration
+	}{
+		{
+			name:       "done on first poll",
+			polls:      1,
+			waiter:     Waiter{Timeout: time.Minute, Interval: time.Millisecond, MaxInterval: time.Millisecond},
+			wantErr:    func(err error) bool { return err == nil },
+			wantPolls:  1,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "done after backoff",
+			polls:      4,
+			waiter:     Waiter{Timeout: time.Minute, Interval: time.Millisecond, MaxInterval: 4 * time.Millisecond},
+			wantErr:    func(err error) bool { return err == nil },
+			wantPolls:  4,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "poll error",
+			polls:      -1,
+			pollErrs:   []error{fatalErr},
+			waiter:     Waiter{Timeout: time.Minute, Interval: time.Millisecond, MaxInterval: time.Millisecond},
+			wantErr:    func(err error) bool { return errors.Is(err, fatalErr) },
+			wantPolls:  1,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "throttling is retried",
+			polls:      3,
+			pollErrs:   []error{throttlingErr, throttlingErr},
+			waiter:     Waiter{Timeout: time.Minute, Interval: time.Millisecond, MaxInterval: time.Millisecond},
+			wantErr:    func(err error) bool { return err == nil },
+			wantPolls:  3,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "error after throttling ends the wait",
+			polls:      -1,
+			pollErrs:   []error{throttlingErr, fatalErr},
+			waiter:     Waiter{Timeout: time.Minute, Interval: time.Millisecond, MaxInterval: time.Millisecond},
+			wantErr:    func(err error) bool { return errors.Is(err, fatalErr) },
+			wantPolls:  2,
+			maxElapsed: time.Second,
+		},
+		{
+			name:     "throttling until the deadline",
+			polls:    -1,
+			pollErrs: []error{throttlingErr, throttlingErr, throttlingErr, throttlingErr, throttlingErr, throttlingErr, throttlingErr, throttlingErr},
+			waiter:   Waiter{Timeout: 20 * time.Millisecond, Interval: 5 * time.Millisecond, MaxInterval: 5 * time.Millisecond},
+			wantErr: func(err error) bool {
+				var timeoutErr *WaitTimeoutError
+				return errors.As(err, &timeoutErr)
+			},
+			maxElapsed: time.Second,
+		},
+		{
+			name:   "timeout",
+			polls:  -1,
+			waiter: Waiter{Timeout: 20 * time.Millisecond, Interval: time.Millisecond, MaxInterval: 5 * time.Millisecond},
+			wantErr: func(err error) bool {
+				var timeoutErr *WaitTimeoutError
+				return errors.As(err, &timeoutErr) && timeoutErr.Status == "CREATE_IN_PROGRESS"
+			},
+			maxElapsed: time.Second,
+		},
+		{
+			name:   "interval clamped to the deadline",
+			polls:  -1,
+			waiter: Waiter{Timeout: 20 * time.Millisecond, Interval: time.Hour, MaxInterval: time.Hour},
+			wantErr: func(err error) bool {
+				var timeoutErr *WaitTimeoutError
+				return errors.As(err, &timeoutErr)
+			},
+			wantPolls:  2,
+			maxElapsed: time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var polls int
+			start := time.Now()
+			err := test.waiter.wait(context.Background(), "stack test", func() (bool, string, error) {
+				polls++
+				if polls <= len(test.pollErrs) {
+					return false, "", test.pollErrs[polls-1]
+				}
+				return polls == test.polls, "CREATE_IN_PROGRESS", nil
+			})
+			elapsed := time.Since(start)
+
+			if !test.wantErr(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if test.wantPolls != 0 && polls != test.wantPolls {
+				t.Errorf("expected %d polls, got %d", test.wantPolls, polls)
+			}
+			if elapsed > test.maxElapsed {
+				t.Errorf("expected the wait to take less than %s, took %s", test.maxElapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestWaiterWaitBackoff(t *testing.T) {
+	waiter := Waiter{Timeout: time.Minute, Interval: 5 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+	var pollTimes []time.Time
+	err := waiter.wait(context.Background(), "stack test", func() (bool, string, error) {
+		pollTimes = append(pollTimes, time.Now())
+		return len(pollTimes) == 5, "UPDATE_IN_PROGRESS", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the interval doubles from Interval up to MaxInterval, sleeps last at least as long
+	wantIntervals := []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond}
+	for i, want := range wantIntervals {
+		if got := pollTimes[i+1].Sub(pollTimes[i]); got < want {
+			t.Errorf("interval %d: expected at least %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestWaiterWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := Waiter{Timeout: time.Minute, Interval: time.Hour, MaxInterval: time.Hour}
+
+	var polls int
+	err := waiter.wait(ctx, "stack test", func() (bool, string, error) {
+		polls++
+		cancel()
+		return false, "UPDATE_IN_PROGRESS", nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if polls != 1 {
+		t.Errorf("expected 1 poll, got %d", polls)
+	}
+}
+
+func TestStackStatus(t *testing.T) {
+	tests := []struct {
+		status                            types.StackStatus
+		inProgress, succeeded, rolledBack bool
+	}{
+		{status: types.StackStatusCreateInProgress, inProgress: true},
+		{status: types.StackStatusReviewInProgress, inProgress: true},
+		{status: types.StackStatusUpdateRollbackInProgress, inProgress: true},
+		{status: types.StackStatusUpdateCompleteCleanupInProgress, inProgress: true},
+		{status: types.StackStatusCreateComplete, succeeded: true},
+		{status: types.StackStatusUpdateComplete, succeeded: true},
+		{status: types.StackStatusImportComplete, succeeded: true},
+		{status: types.StackStatusDeleteComplete, succeeded: true},
+		{status: types.StackStatusRollbackComplete, rolledBack: true},
+		{status: types.StackStatusUpdateRollbackComplete, rolledBack: true},
+		{status: types.StackStatusImportRollbackComplete, rolledBack: true},
+		{status: types.StackStatusRollbackFailed, rolledBack: true},
+		{status: types.StackStatusCreateFailed},
+		{status: types.StackStatusDeleteFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.status), func(t *testing.T) {
+			if got := StackStatusInProgress(test.status); got != test.inProgress {
+				t.Errorf("StackStatusInProgress: expected %t, got %t", test.inProgress, got)
+			}
+			if got := StackStatusSucceeded(test.status); got != test.succeeded {
+				t.Errorf("StackStatusSucceeded: expected %t, got %t", test.succeeded, got)
+			}
+			if got := StackStatusRolledBack(test.status); got != test.rolledBack {
+				t.Errorf("StackStatusRolledBack: expected %t, got %t", test.rolledBack, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package logger
+
+import "os"
+
+// exit codes of stax, when several apply the most severe one wins, in decreasing order:
+// ExitCancelled, ExitRolledBack, ExitChangeSetFailed, ExitTimeout, ExitAWSAuth, ExitValidation, ExitError, ExitDiff
+const (
+	ExitOK              = 0
+	ExitError           = 1
+	ExitValidation      = 2
+	ExitAWSAuth         = 3
+	ExitChangeSetFailed = 4
+	ExitRolledBack      = 5
+	ExitDiff            = 6
+	ExitTimeout         = 7
+	ExitCancelled       = 130
+)
+
+var exitSeverity = map[int]int{
+	ExitOK:              0,
+	ExitDiff:            1,
+	ExitError:           2,
+	ExitValidation:      3,
+	ExitAWSAuth:         4,
+	ExitTimeout:         5,
+	ExitChangeSetFailed: 6,
+	ExitRolledBack:      7,
+	ExitCancelled:       8,
+}
+
+// Abort is the panic value of Fatal, it unwinds the command so that deferred calls, Flush included, still run
+type Abort struct{}
+
+// SetClassifier sets the function returning the exit code of errors passed to Error, Errorf, Fatal and Fatalf.
+// Without one, or for arguments that are not errors, the exit code is ExitError
+func (l *Logger) SetClassifier(classifier func(error) int) {
+	l.classifier = classifier
+}
+
+// SetExitCode records code as the exit code unless a more severe one was already recorded
+func (l *Logger) SetExitCode(code int) {
+	if exitSeverity[code] > exitSeverity[l.exitCode] {
+		l.exitCode = code
+	}
+}
+
+// ExitCode returns the exit code recorded so far
+func (l *Logger) ExitCode() int {
+	return l.exitCode
+}
+
+// classify records the exit code of the arguments of a logged error
+func (l *Logger) classify(args []interface{}) {
+	code := ExitError
+	for _, arg := range args {
+		if err, ok := arg.(error); ok && l.classifier != nil {
+			if errCode := l.classifier(err); exitSeverity[errCode] > exitSeverity[code] {
+				code = errCode
+			}
+		}
+	}
+	l.SetExitCode(code)
+}
+
+// Flush exits with the recorded exit code if it is not ExitOK
+func (l *Logger) Flush() {
+	if l.exitCode != ExitOK {
+		l.Close()
+		os.Exit(l.exitCode)
+	}
+}
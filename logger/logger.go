@@ -2,17 +2,43 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 )
 
+// Mask replaces secret values in every line printed by the logger
+const Mask = "****"
+
+// minSecretLength is the length under which values are not masked, masking every "1" or "on" would garble the output
+const minSecretLength = 4
+
 // Logger is a sugar coating around log.Logger
 type Logger struct {
-	debug  bool
-	errors int
-	au     aurora.Aurora
+	debug          bool
+	errors         int
+	exitCode       int
+	classifier     func(error) int
+	results        []StackResult
+	current        *StackResult
+	au             aurora.Aurora
+	stdout, stderr io.Writer
+
+	// structured output, see structured.go
+	format  string
+	file    *os.File
+	fields  Fields
+	now     func() time.Time
+	fieldMu sync.RWMutex
+
+	secretsMu sync.RWMutex
+	secrets   map[string]bool
+	redactor  *strings.Replacer
 }
 
 var logger *Logger
@@ -25,6 +51,10 @@ func NewLogger(debug, noColor bool) *Logger {
 			debug:  debug,
 			errors: 0,
 			au:     aurora.NewAurora(!noColor), // flip noColor. --no-color -> noColor=true therefore colors=!noColor=false
+			stdout: os.Stdout,
+			stderr: os.Stderr,
+			format: FormatText,
+			now:    time.Now,
 		}
 	})
 	return logger
@@ -32,85 +62,123 @@ func NewLogger(debug, noColor bool) *Logger {
 
 // Debug prints to stdout only if --debug is set
 func (l *Logger) Debug(args ...interface{}) {
-	if l.debug {
-		l.Info(args...)
-	}
-
+	l.output(LevelDebug, "", fmt.Sprintln(args...))
 }
 
 // Debugf prints formatted text to stdout only if --debug is set
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	if l.debug {
-		l.Infof(format, args...)
-	}
-
+	l.output(LevelDebug, "", fmt.Sprintf(format, args...))
 }
 
 // Info prints to stdout
 func (l *Logger) Info(args ...interface{}) {
-	fmt.Fprintln(os.Stdout, args...)
+	l.output(LevelInfo, "", fmt.Sprintln(args...))
 }
 
 // Infof prints formatted text to stdout
 func (l *Logger) Infof(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stdout, format, args...)
+	l.output(LevelInfo, "", fmt.Sprintf(format, args...))
 }
 
 // Warn prints to stderr
 func (l *Logger) Warn(args ...interface{}) {
-	fmt.Fprintln(os.Stdout, l.au.Yellow(fmt.Sprint(args...)))
+	l.output(LevelWarn, "", fmt.Sprintln(args...))
 }
 
 // Warnf prints to stderr
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	fmt.Fprint(os.Stdout, l.au.Yellow(fmt.Sprintf(format, args...)))
+	l.output(LevelWarn, "", fmt.Sprintf(format, args...))
 }
 
 // Error prints to stderr
 func (l *Logger) Error(args ...interface{}) {
 	l.errors++
-	fmt.Fprintln(os.Stderr, l.au.Red(fmt.Sprint(args...)))
+	l.classify(args)
+	l.failStack()
+	l.output(LevelError, "", fmt.Sprintln(args...))
 }
 
 // Errorf prints to stderr
 func (l *Logger) Errorf(format string, args ...interface{}) {
 	l.errors++
-	fmt.Fprint(os.Stderr, l.au.Red(fmt.Sprintf(format, args...)))
+	l.classify(args)
+	l.failStack()
+	l.output(LevelError, "", fmt.Sprintf(format, args...))
 }
 
-// Fatal prints to stderr and exits 1
+// Fatal prints to stderr and aborts the command, see Abort
 func (l *Logger) Fatal(args ...interface{}) {
 	l.Error(args...)
-	l.Flush()
+	panic(Abort{})
 }
 
-// Fatalf prints formatted output to stderr and exits 1
+// Fatalf prints formatted output to stderr and aborts the command, see Abort
 func (l *Logger) Fatalf(format string, args ...interface{}) {
 	l.Errorf(format, args...)
-	l.Flush()
+	panic(Abort{})
 }
 
 // Check prints a green check mark at the end of the current line
 func (l *Logger) Check() {
-	l.Infof(" %s\n", l.au.Green("✓"))
+	l.output(LevelInfo, EventOK, fmt.Sprintf(" %s\n", l.au.Green("✓")))
 }
 
 // X prints a red x mark at the end of the current line
 func (l *Logger) X() {
-	l.Infof(" %s\n", l.au.Red("🅇"))
+	l.output(LevelInfo, EventFailed, fmt.Sprintf(" %s\n", l.au.Red("🅇")))
 }
 
-// Flush will call os.Exit if logger accumulated errors
-func (l *Logger) Flush() {
-	if l.errors > 0 {
-		if l.errors > 125 {
-			l.errors = 125
+// NumErrors returns the number of errors counted so far
+func (l *Logger) NumErrors() int {
+	return l.errors
+}
+
+// AddSecrets registers values resolved during the run, such as decrypted overrides or NoEcho parameters,
+// to be masked from then on in everything the logger prints. Values shorter than 4 characters are not masked
+func (l *Logger) AddSecrets(values ...string) {
+	l.secretsMu.Lock()
+	defer l.secretsMu.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < minSecretLength || l.secrets[value] {
+			continue
 		}
-		os.Exit(l.errors)
+		if l.secrets == nil {
+			l.secrets = make(map[string]bool)
+		}
+		l.secrets[value] = true
+		added = true
+	}
+	if !added {
+		return
+	}
+
+	// longest first so that a secret containing another one is masked whole
+	secrets := make([]string, 0, len(l.secrets))
+	for secret := range l.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	oldNew := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		oldNew = append(oldNew, secret, Mask)
 	}
+	l.redactor = strings.NewReplacer(oldNew...)
 }
 
-// NumErrors returns the number of errors counted so far
-func (l *Logger) NumErrors() int {
-	return l.errors
+// Redact returns text with every registered secret masked
+func (l *Logger) Redact(text string) string {
+	l.secretsMu.RLock()
+	defer l.secretsMu.RUnlock()
+
+	if l.redactor == nil {
+		return text
+	}
+	return l.redactor.Replace(text)
 }
@@ -0,0 +1,185 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+func newTestLogger(debug bool) (*Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	return &Logger{debug: debug, au: aurora.NewAurora(false), stdout: &out, stderr: &out}, &out
+}
+
+func TestRedactMasksEveryOutput(t *testing.T) {
+	secret := "s3cr3t-p4ssw0rd"
+	log, out := newTestLogger(true)
+	log.AddSecrets(secret)
+
+	log.Debug("debug", secret)
+	log.Debugf("debugf %s\n", secret)
+	log.Info("info", secret)
+	log.Infof("infof %s\n", secret)
+	log.Warn("warn", secret)
+	log.Warnf("warnf %s\n", secret)
+	log.Error("error", secret)
+	log.Errorf("errorf %s\n", secret)
+
+	if strings.Contains(out.String(), secret) {
+		t.Fatalf("secret leaked:\n%s", out.String())
+	}
+	if got := strings.Count(out.String(), Mask); got != 8 {
+		t.Fatalf("expected 8 masks, got %d:\n%s", got, out.String())
+	}
+}
+
+func TestRedactDebugDump(t *testing.T) {
+	type parameter struct {
+		ParameterKey   string
+		ParameterValue *string
+	}
+	secret := "hunter2hunter2"
+	log, out := newTestLogger(true)
+	log.AddSecrets(secret)
+
+	log.Debugf("%+v\n", []parameter{{ParameterKey: "DbPassword", ParameterValue: &secret}})
+	log.Debugf("%#v\n", map[string]string{"DbPassword": secret})
+
+	if strings.Contains(out.String(), secret) {
+		t.Fatalf("secret leaked:\n%s", out.String())
+	}
+}
+
+func TestRedactRenderedTable(t *testing.T) {
+	secret := "multi\nline\nsecret"
+	log, out := newTestLogger(false)
+	log.AddSecrets(secret)
+
+	table := log.NewTable("Key", "Value")
+	table.Append([]string{"DbPassword", secret})
+	table.Render()
+
+	if strings.Contains(out.String(), "multi") || !strings.Contains(out.String(), Mask) {
+		t.Fatalf("secret leaked:\n%s", out.String())
+	}
+}
+
+func TestRedactLongestFirst(t *testing.T) {
+	log, _ := newTestLogger(false)
+	log.AddSecrets("abcd", "abcdefgh")
+
+	if got := log.Redact("abcdefgh abcd"); got != Mask+" "+Mask {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRedactIgnoresShortValues(t *testing.T) {
+	log, _ := newTestLogger(false)
+	log.AddSecrets("", "on", "1")
+
+	text := "Enabled: on, Count: 1"
+	if got := log.Redact(text); got != text {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestDebugSilentWithoutFlag(t *testing.T) {
+	log, out := newTestLogger(false)
+
+	log.Debug("hidden")
+	log.Debugf("%s\n", "hidden")
+
+	if out.Len() > 0 {
+		t.Fatalf("expected no output, got %q", out.String())
+	}
+}
+
+func TestJSONEntries(t *testing.T) {
+	log, out := newTestLogger(false)
+	log.format = FormatJSON
+	log.now = func() time.Time { return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC) }
+	log.AddSecrets("s3cr3t-p4ssw0rd")
+	log.SetCommand("deploy")
+	log.SetStack("app-prod", "prod", "us-east-1")
+
+	log.Infof("  Applying overrides: %s ", log.au.Green("s3cr3t-p4ssw0rd"))
+	log.Check()
+	log.Debug("hidden")
+	log.Info()
+
+	expected := `{"timestamp":"2021-01-02T03:04:05Z","level":"info","command":"deploy","stack":"app-prod","profile":"prod","region":"us-east-1","message":"Applying overrides: ****"}
+{"timestamp":"2021-01-02T03:04:05Z","level":"info","command":"deploy","stack":"app-prod","profile":"prod","region":"us-east-1","event":"ok"}
+`
+	if out.String() != expected {
+		t.Fatalf("got:\n%s", out.String())
+	}
+}
+
+func TestExitCodeSeverity(t *testing.T) {
+	log, _ := newTestLogger(false)
+	log.SetClassifier(func(err error) int { return ExitAWSAuth })
+
+	log.SetExitCode(ExitDiff)
+	log.Errorf("not an error value\n")
+	if log.ExitCode() != ExitError {
+		t.Fatalf("expected %d, got %d", ExitError, log.ExitCode())
+	}
+
+	log.Error(errors.New("expired"))
+	log.SetExitCode(ExitValidation)
+	if log.ExitCode() != ExitAWSAuth {
+		t.Fatalf("expected %d, got %d", ExitAWSAuth, log.ExitCode())
+	}
+}
+
+func TestFatalAborts(t *testing.T) {
+	log, _ := newTestLogger(false)
+	defer func() {
+		if _, ok := recover().(Abort); !ok {
+			t.Fatal("expected Fatal to panic with Abort")
+		}
+	}()
+	log.Fatal("fatal")
+	t.Fatal("Fatal returned")
+}
+
+func TestSummary(t *testing.T) {
+	log, out := newTestLogger(false)
+
+	log.BeginStack("a", "p", "r")
+	log.EndStack()
+	log.BeginStack("b", "p", "r")
+	log.SkipStack("no changes")
+	log.EndStack()
+	log.BeginStack("c", "p", "r")
+	log.Error("boom")
+	log.SkipStack("no changes")
+	log.Summary()
+
+	for _, expected := range []string{"a p:r succeeded", "b p:r skipped (no changes)", "c p:r failed", "1 succeeded, 1 skipped, 1 failed"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestUseStderr(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log := &Logger{au: aurora.NewAurora(false), stdout: &stdout, stderr: &stderr}
+	log.UseStderr()
+
+	log.Info("info")
+	log.Infof("infof\n")
+	log.Check()
+
+	if stdout.Len() > 0 {
+		t.Fatalf("expected nothing on stdout, got:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "infof") {
+		t.Fatalf("expected info on stderr, got:\n%s", stderr.String())
+	}
+}
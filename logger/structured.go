@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// log formats, selected with --log-format or STAX_LOG_FORMAT
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// levels of log entries
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// events of log entries marking the outcome of the step printed on the current line
+const (
+	EventOK     = "ok"
+	EventFailed = "failed"
+)
+
+// Fields are the context of the entries logged while they are set
+type Fields struct {
+	Command string `json:"command,omitempty"`
+	Stack   string `json:"stack,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// entry is a json line of the structured format
+type entry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Fields
+	Event   string `json:"event,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ansiColors matches the escape sequences of aurora colors
+var ansiColors = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// SetFormat selects the console format, text or json
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+		l.format = format
+		return nil
+	case "":
+		l.format = FormatText
+		return nil
+	}
+	return fmt.Errorf("unknown log format %s, expected %s or %s", format, FormatText, FormatJSON)
+}
+
+// UseStderr sends the console output of every level to stderr, keeping stdout for the data a command prints
+func (l *Logger) UseStderr() {
+	l.stdout = l.stderr
+}
+
+// OpenFile appends every entry, including debug ones, to the file at path in the console format, without colors
+func (l *Logger) OpenFile(path string) error {
+	file, openErr := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if openErr != nil {
+		return openErr
+	}
+	l.file = file
+	return nil
+}
+
+// Close closes the file opened by OpenFile
+func (l *Logger) Close() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// SetCommand sets the command of the entries that follow
+func (l *Logger) SetCommand(command string) {
+	l.fieldMu.Lock()
+	defer l.fieldMu.Unlock()
+	l.fields.Command = command
+}
+
+// SetStack sets the stack, profile and region of the entries that follow, empty values clear them
+func (l *Logger) SetStack(stack, profile, region string) {
+	l.fieldMu.Lock()
+	defer l.fieldMu.Unlock()
+	l.fields.Stack, l.fields.Profile, l.fields.Region = stack, profile, region
+}
+
+// output writes text to the console according to level and --debug, and to the log file whatever the level
+func (l *Logger) output(level, event, text string) {
+	text = l.Redact(text)
+
+	if level != LevelDebug || l.debug {
+		console := l.stdout
+		if level == LevelError {
+			console = l.stderr
+		}
+		if l.format == FormatJSON {
+			l.writeEntry(console, level, event, text)
+		} else {
+			switch level {
+			case LevelWarn:
+				fmt.Fprint(console, l.au.Yellow(text))
+			case LevelError:
+				fmt.Fprint(console, l.au.Red(text))
+			default:
+				fmt.Fprint(console, text)
+			}
+		}
+	}
+
+	if l.file != nil {
+		if l.format == FormatJSON {
+			l.writeEntry(l.file, level, event, text)
+		} else {
+			fmt.Fprint(l.file, ansiColors.ReplaceAllString(text, ""))
+		}
+	}
+}
+
+// writeEntry writes text as a json line, skipping blank lines that carry no event
+func (l *Logger) writeEntry(w io.Writer, level, event, text string) {
+	message := strings.TrimSpace(ansiColors.ReplaceAllString(text, ""))
+	if event != "" {
+		// the check mark or x is replaced by the event
+		message = ""
+	}
+	if message == "" && event == "" {
+		return
+	}
+
+	l.fieldMu.RLock()
+	line, _ := json.Marshal(entry{
+		Timestamp: l.now().UTC().Format(time.RFC3339Nano),
+		Level:     level,
+		Fields:    l.fields,
+		Event:     event,
+		Message:   message,
+	})
+	l.fieldMu.RUnlock()
+
+	fmt.Fprintf(w, "%s\n", line)
+}
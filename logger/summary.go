@@ -0,0 +1,83 @@
+package logger
+
+import "fmt"
+
+// results of a stack
+const (
+	StackSucceeded = "succeeded"
+	StackSkipped   = "skipped"
+	StackFailed    = "failed"
+)
+
+// StackResult is the outcome of a command for a single stack
+type StackResult struct {
+	Stack, Profile, Region string
+	Result, Reason         string
+}
+
+// BeginStack sets the stack context and records a result for the stack, succeeded unless an error is logged or
+// SkipStack is called before EndStack
+func (l *Logger) BeginStack(stack, profile, region string) {
+	l.SetStack(stack, profile, region)
+	l.results = append(l.results, StackResult{Stack: stack, Profile: profile, Region: region, Result: StackSucceeded})
+	l.current = &l.results[len(l.results)-1]
+}
+
+// SkipStack records the current stack as skipped for the given reason
+func (l *Logger) SkipStack(reason string) {
+	if l.current != nil && l.current.Result != StackFailed {
+		l.current.Result = StackSkipped
+		l.current.Reason = reason
+	}
+}
+
+// EndStack clears the stack context
+func (l *Logger) EndStack() {
+	l.current = nil
+	l.SetStack("", "", "")
+}
+
+// Results returns the results recorded by BeginStack
+func (l *Logger) Results() []StackResult {
+	return l.results
+}
+
+// failStack records the current stack as failed
+func (l *Logger) failStack() {
+	if l.current != nil {
+		l.current.Result = StackFailed
+		l.current.Reason = ""
+	}
+}
+
+// Summary prints the result of every stack when the command processed more than one
+func (l *Logger) Summary() {
+	// the summary is printed while aborting too, stacks in progress have failed
+	l.current = nil
+	if len(l.results) < 2 {
+		return
+	}
+
+	var succeeded, skipped, failed int
+	l.Info()
+	for _, result := range l.results {
+		var mark interface{}
+		switch result.Result {
+		case StackSucceeded:
+			succeeded++
+			mark = l.au.Green("✓")
+		case StackSkipped:
+			skipped++
+			mark = l.au.Yellow("-")
+		default:
+			failed++
+			mark = l.au.Red("🅇")
+		}
+		line := fmt.Sprintf("%s %s %s:%s %s", mark, l.au.Magenta(result.Stack), l.au.Green(result.Profile), l.au.Cyan(result.Region), result.Result)
+		if result.Reason != "" {
+			line += " (" + result.Reason + ")"
+		}
+		l.output(LevelInfo, "", line+"\n")
+	}
+	l.Infof("%d succeeded, %d skipped, %d failed\n", succeeded, skipped, failed)
+}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"bytes"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Table is a tablewriter.Table that prints through the logger
+type Table struct {
+	*tablewriter.Table
+	buffer bytes.Buffer
+	log    *Logger
+}
+
+// NewTable returns a table with white headers and no text wrapping. Print tables only through it: cells are masked
+// as they are appended, before a multiline secret is split across rows, and the rendered table is printed with Infof
+func (l *Logger) NewTable(header ...string) *Table {
+	table := &Table{log: l}
+	table.Table = tablewriter.NewWriter(&table.buffer)
+	table.SetAutoWrapText(false)
+	table.SetHeader(header)
+	colors := make([]tablewriter.Colors, len(header))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.FgWhiteColor}
+	}
+	table.SetHeaderColor(colors...)
+	return table
+}
+
+// Append adds a row with every registered secret masked
+func (t *Table) Append(row []string) {
+	redacted := make([]string, len(row))
+	for i, cell := range row {
+		redacted[i] = t.log.Redact(cell)
+	}
+	t.Table.Append(redacted)
+}
+
+// Render prints the table through the logger
+func (t *Table) Render() {
+	t.Table.Render()
+	t.log.Infof("%s", t.buffer.String())
+	t.buffer.Reset()
+}